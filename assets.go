@@ -0,0 +1,8 @@
+package main
+
+import "embed"
+
+// Templates and static files compiled into the binary, so the server can be started from any directory
+//
+//go:embed templates static
+var assets embed.FS
@@ -0,0 +1,275 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Akhanrok/go_labs/services/throttle_service"
+)
+
+type Config struct {
+	Addr             string
+	BaseURL          string
+	DatabaseDSN      string
+	PasswordHasher   string
+	PasswordResetTTL time.Duration
+	Session          SessionConfig
+	Mail             MailConfig
+	Verification     VerificationConfig
+	LoginThrottle    throttle_service.Config
+	ResendThrottle   throttle_service.Config
+	// TrashRetentionDays is how long deleted lists stay in the trash before they are purged
+	TrashRetentionDays int
+	// ScheduleLocation is the time zone the days of recurring lists are counted in
+	ScheduleLocation *time.Location
+}
+
+type SessionConfig struct {
+	// KeyPairs holds hash and block keys in turn, the first pair signs new cookies
+	KeyPairs   [][]byte
+	CookieName string
+	Secure     bool
+	HttpOnly   bool
+	SameSite   http.SameSite
+	MaxAge     int
+}
+
+type MailConfig struct {
+	// Driver is one of "stdout", "file" or "smtp"
+	Driver       string
+	FilePath     string
+	From         string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+}
+
+type VerificationConfig struct {
+	// Secret signs verification links, a key derived from the first session hash key is used when it is empty
+	Secret  []byte
+	LinkTTL time.Duration
+	// GracePeriod is how long a new account may be used fully before the email is verified
+	GracePeriod time.Duration
+}
+
+// Load the configuration from environment variables, falling back to defaults
+func Load() (*Config, error) {
+	cfg := &Config{
+		Addr:           getEnv("ADDR", ":8080"),
+		BaseURL:        strings.TrimSuffix(getEnv("APP_BASE_URL", "http://localhost:8080"), "/"),
+		DatabaseDSN:    getEnv("DATABASE_DSN", "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"),
+		PasswordHasher: os.Getenv("PASSWORD_HASHER"),
+		Session: SessionConfig{
+			CookieName: getEnv("SESSION_COOKIE_NAME", "session-name"),
+		},
+		Mail: MailConfig{
+			Driver:       getEnv("MAIL_DRIVER", "stdout"),
+			FilePath:     getEnv("MAIL_FILE", "mail.log"),
+			From:         getEnv("MAIL_FROM", "ShoppingList <no-reply@localhost>"),
+			SMTPHost:     os.Getenv("SMTP_HOST"),
+			SMTPPort:     getEnv("SMTP_PORT", "587"),
+			SMTPUsername: os.Getenv("SMTP_USERNAME"),
+			SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		},
+	}
+
+	var err error
+
+	cfg.Session.KeyPairs, err = ParseSessionKeys(os.Getenv("SESSION_KEYS"))
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Session.Secure, err = getBool("SESSION_SECURE", false)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Session.HttpOnly, err = getBool("SESSION_HTTP_ONLY", true)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Session.SameSite, err = parseSameSite(getEnv("SESSION_SAME_SITE", "lax"))
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Session.MaxAge, err = getInt("SESSION_MAX_AGE", 86400*30)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.PasswordResetTTL, err = getDuration("PASSWORD_RESET_TTL", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret := os.Getenv("EMAIL_VERIFICATION_SECRET"); secret != "" {
+		cfg.Verification.Secret, err = base64.StdEncoding.DecodeString(secret)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EMAIL_VERIFICATION_SECRET: %w", err)
+		}
+	}
+
+	cfg.LoginThrottle = throttle_service.DefaultConfig
+
+	cfg.LoginThrottle.LockoutThreshold, err = getInt("LOGIN_LOCKOUT_THRESHOLD", cfg.LoginThrottle.LockoutThreshold)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.LoginThrottle.LockoutDuration, err = getDuration("LOGIN_LOCKOUT_DURATION", cfg.LoginThrottle.LockoutDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.ResendThrottle = throttle_service.ResendConfig
+
+	cfg.Verification.LinkTTL, err = getDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Verification.GracePeriod, err = getDuration("EMAIL_VERIFICATION_GRACE_PERIOD", 72*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.TrashRetentionDays, err = getInt("TRASH_RETENTION_DAYS", 30)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TrashRetentionDays < 1 {
+		return nil, fmt.Errorf("TRASH_RETENTION_DAYS must be at least 1")
+	}
+
+	cfg.ScheduleLocation, err = time.LoadLocation(getEnv("SCHEDULE_TIMEZONE", "UTC"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SCHEDULE_TIMEZONE: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// Parse a comma separated list of base64 encoded "hashKey:blockKey" entries.
+// The first entry is used to sign new cookies, the rest only to verify existing ones,
+// so keys are rotated by prepending a new entry and dropping the oldest one later.
+func ParseSessionKeys(value string) ([][]byte, error) {
+	var pairs [][]byte
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 2)
+
+		hashKey, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid session hash key: %w", err)
+		}
+		if len(hashKey) < 32 {
+			return nil, fmt.Errorf("session hash key must be at least 32 bytes long")
+		}
+
+		var blockKey []byte
+		if len(parts) == 2 {
+			blockKey, err = base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid session block key: %w", err)
+			}
+			if l := len(blockKey); l != 16 && l != 24 && l != 32 {
+				return nil, fmt.Errorf("session block key must be 16, 24 or 32 bytes long")
+			}
+		}
+
+		pairs = append(pairs, hashKey, blockKey)
+	}
+
+	return pairs, nil
+}
+
+// Generate a random key pair for development, sessions will not survive a restart
+func GenerateSessionKeys() ([][]byte, error) {
+	hashKey := make([]byte, 64)
+	if _, err := rand.Read(hashKey); err != nil {
+		return nil, err
+	}
+
+	blockKey := make([]byte, 32)
+	if _, err := rand.Read(blockKey); err != nil {
+		return nil, err
+	}
+
+	return [][]byte{hashKey, blockKey}, nil
+}
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getBool(key string, fallback bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return b, nil
+}
+
+func getInt(key string, fallback int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return i, nil
+}
+
+func getDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return d, nil
+}
+
+func parseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(value) {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	case "default":
+		return http.SameSiteDefaultMode, nil
+	default:
+		return 0, fmt.Errorf("invalid SESSION_SAME_SITE %q", value)
+	}
+}
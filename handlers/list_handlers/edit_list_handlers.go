@@ -0,0 +1,333 @@
+package list_handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Akhanrok/go_labs/repositories/list_invitation_repository"
+	"github.com/Akhanrok/go_labs/repositories/list_member_repository"
+	"github.com/Akhanrok/go_labs/repositories/list_repository"
+	"github.com/Akhanrok/go_labs/repositories/product_repository"
+	"github.com/Akhanrok/go_labs/repositories/share_link_repository"
+	"github.com/Akhanrok/go_labs/services"
+	"github.com/Akhanrok/go_labs/services/event_service"
+	"github.com/Akhanrok/go_labs/services/session_service"
+	"github.com/gorilla/sessions"
+)
+
+func EditListHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, ok := accessibleList(w, r, db, list_member_repository.RoleViewer)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("ETag", list.ETag())
+	renderEditList(w, r, db, list, "")
+}
+
+func RenameListHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store, broker event_service.Broker) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, ok := accessibleList(w, r, db, list_member_repository.RoleEditor)
+	if !ok {
+		return
+	}
+
+	name := strings.TrimSpace(r.PostForm.Get("listName"))
+	if message := validateName(name, "List name"); message != "" {
+		renderEditList(w, r, db, list, message)
+		return
+	}
+
+	if name != list.ListName {
+		listRepo := list_repository.NewListRepository(db)
+
+		// List names are unique among the lists of the owner, also when an editor renames
+		listExists, err := listRepo.IsListExists(list.OwnerID, name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if listExists {
+			renderEditList(w, r, db, list, "The list with such name already exists")
+			return
+		}
+
+		err = listRepo.RenameList(list.OwnerID, list.ID, name, formVersion(r, list.Version))
+		if err == list_repository.ErrVersionConflict {
+			renderConflict(w, r, db, list.ID, listConflict{Action: "/rename-list", Name: name})
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		publish(broker, list.ID, event_service.ListRenamed, listEventData{ListID: list.ID, Name: name, Archived: list.Archived})
+	}
+
+	redirectToList(w, r, store, list.ID, "The list has been renamed")
+}
+
+func AddProductHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store, broker event_service.Broker) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, ok := accessibleList(w, r, db, list_member_repository.RoleEditor)
+	if !ok {
+		return
+	}
+
+	product, errorMessage := parseProduct(r)
+	if errorMessage != "" {
+		renderEditList(w, r, db, list, errorMessage)
+		return
+	}
+
+	productID, err := product_repository.NewProductRepository(db).AddProduct(list.ID, product)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// A new product means the list is not done anymore
+	err = list_repository.NewListRepository(db).Unarchive(list.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	product.ID = productID
+	publishProduct(broker, list.ID, event_service.ProductAdded, product)
+	if list.Archived {
+		publish(broker, list.ID, event_service.ListArchived, listEventData{ListID: list.ID, Archived: false})
+	}
+
+	redirectToList(w, r, store, list.ID, fmt.Sprintf("%s has been added", product.Product))
+}
+
+func UpdateProductHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store, broker event_service.Broker) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, ok := accessibleList(w, r, db, list_member_repository.RoleEditor)
+	if !ok {
+		return
+	}
+
+	product, errorMessage := parseProduct(r)
+	if errorMessage != "" {
+		renderEditList(w, r, db, list, errorMessage)
+		return
+	}
+
+	product.ID, _ = strconv.Atoi(r.PostForm.Get("productId"))
+
+	// The product may have been removed since the form was loaded
+	current, ok := findProduct(list, product.ID)
+	if !ok {
+		renderConflict(w, r, db, list.ID, listConflict{Action: "/update-product", Product: product})
+		return
+	}
+	product.Purchased = current.Purchased
+	product.Version = formVersion(r, current.Version)
+
+	// The update is scoped to the list, so products of other lists cannot be changed
+	err := product_repository.NewProductRepository(db).UpdateProduct(list.ID, product)
+	if err == product_repository.ErrVersionConflict {
+		renderConflict(w, r, db, list.ID, listConflict{Action: "/update-product", Product: product})
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	publishProduct(broker, list.ID, event_service.ProductUpdated, product)
+
+	redirectToList(w, r, store, list.ID, fmt.Sprintf("%s has been updated", product.Product))
+}
+
+func RemoveProductHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store, broker event_service.Broker) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, ok := accessibleList(w, r, db, list_member_repository.RoleEditor)
+	if !ok {
+		return
+	}
+
+	productID, _ := strconv.Atoi(r.PostForm.Get("productId"))
+
+	product, ok := findProduct(list, productID)
+	if !ok {
+		renderConflict(w, r, db, list.ID, listConflict{Action: "/remove-product", Product: product_repository.Product{ID: productID}})
+		return
+	}
+
+	err := product_repository.NewProductRepository(db).RemoveProduct(list.ID, productID, formVersion(r, product.Version))
+	if err == product_repository.ErrVersionConflict {
+		renderConflict(w, r, db, list.ID, listConflict{Action: "/remove-product", Product: product})
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	publishProduct(broker, list.ID, event_service.ProductRemoved, product)
+
+	redirectToList(w, r, store, list.ID, "The product has been removed")
+}
+
+// Load the list named by the "id" parameter if the current user has at least the given role on it,
+// otherwise write the error response and return false
+func accessibleList(w http.ResponseWriter, r *http.Request, db *sql.DB, role string) (*list_repository.ListData, bool) {
+	user, ok := session_service.UserFromContext(r.Context())
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return nil, false
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	listID, err := strconv.Atoi(r.Form.Get("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+
+	list, err := list_repository.NewListRepository(db).GetList(user.ID, listID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if list == nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+
+	if !list.HasRole(role) {
+		http.Error(w, "You are not allowed to change this list", http.StatusForbidden)
+		return nil, false
+	}
+
+	// Clients sending If-Match only change the list in the state they have seen
+	if r.Method != http.MethodGet && !matchesETag(r.Header.Get("If-Match"), list.ETag()) {
+		http.Error(w, "The list has been changed by someone else", http.StatusPreconditionFailed)
+		return nil, false
+	}
+
+	return list, true
+}
+
+// Read the product fields of the add and update forms, the error message is empty when they are valid
+func parseProduct(r *http.Request) (product_repository.Product, string) {
+	row := productRow{
+		Product:  strings.TrimSpace(r.PostForm.Get("product")),
+		Quantity: strings.TrimSpace(r.PostForm.Get("quantity")),
+		Store:    strings.TrimSpace(r.PostForm.Get("store")),
+	}
+	product := validateProductRow(&row)
+
+	for _, message := range []string{row.ProductError, row.QuantityError, row.StoreError} {
+		if message != "" {
+			return product, message
+		}
+	}
+	return product, ""
+}
+
+func renderEditList(w http.ResponseWriter, r *http.Request, db *sql.DB, list *list_repository.ListData, errorMessage string) {
+	renderEditListPage(w, r, db, list, errorMessage, nil)
+}
+
+// Everything the edit page shows
+type editListPage struct {
+	List         *list_repository.ListData
+	Members      []list_member_repository.Member
+	Invitations  []list_invitation_repository.Invitation
+	Links        []share_link_repository.ShareLink
+	ErrorMessage string
+	Conflict     *listConflict
+	Schedule     *scheduleForm
+	// NewLink is the share link just created, shown only in the response that created it
+	NewLink string
+}
+
+func renderEditListPage(w http.ResponseWriter, r *http.Request, db *sql.DB, list *list_repository.ListData, errorMessage string, conflict *listConflict) {
+	data, err := loadEditListPage(db, list, errorMessage, conflict)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	services.RenderTemplate(w, r, "edit-list.html", data)
+}
+
+// Load the parts of the edit page beyond the list, before any status is written
+func loadEditListPage(db *sql.DB, list *list_repository.ListData, errorMessage string, conflict *listConflict) (*editListPage, error) {
+	data := &editListPage{
+		List:         list,
+		ErrorMessage: errorMessage,
+		Conflict:     conflict,
+	}
+
+	// Only the owner manages who the list is shared with and when it recurs
+	if list.HasRole(list_member_repository.RoleOwner) {
+		var err error
+		data.Members, err = list_member_repository.NewListMemberRepository(db).GetMembers(list.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		data.Invitations, err = list_invitation_repository.NewListInvitationRepository(db).GetInvitations(list.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		data.Links, err = share_link_repository.NewShareLinkRepository(db).GetActiveLinks(list.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		data.Schedule, err = loadScheduleForm(db, list.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+func redirectToList(w http.ResponseWriter, r *http.Request, store sessions.Store, listID int, message string) {
+	err := session_service.AddFlash(w, r, store, session_service.FlashInfo, message)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/edit-list?id=%d", listID), http.StatusFound)
+}
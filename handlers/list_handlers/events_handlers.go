@@ -0,0 +1,177 @@
+package list_handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Akhanrok/go_labs/repositories/list_repository"
+	"github.com/Akhanrok/go_labs/repositories/product_repository"
+	"github.com/Akhanrok/go_labs/services/event_service"
+	"github.com/Akhanrok/go_labs/services/session_service"
+)
+
+const (
+	// A page follows at most this many lists over one connection
+	maxFollowedLists = 100
+	// Comments sent while nothing happens keep proxies from closing the connection
+	keepAliveInterval = 30 * time.Second
+	// How often an open stream checks that the user can still see its lists
+	accessCheckInterval = time.Minute
+)
+
+// Product as sent to the browsers in list events
+type productPayload struct {
+	ID        int    `json:"id"`
+	Product   string `json:"product"`
+	Quantity  int    `json:"quantity"`
+	Store     string `json:"store"`
+	Purchased bool   `json:"purchased"`
+}
+
+type productEventData struct {
+	ListID  int            `json:"listId"`
+	Product productPayload `json:"product"`
+}
+
+type listEventData struct {
+	ListID   int    `json:"listId"`
+	Name     string `json:"name,omitempty"`
+	Archived bool   `json:"archived"`
+}
+
+// Stream the changes of the lists given by the "id" parameters as Server-Sent Events.
+// Browsers reconnect on their own and send the Last-Event-ID header to replay what they missed.
+func ListEventsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, broker event_service.Broker) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := session_service.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	seen := map[int]bool{}
+	var listIDs []int
+	for _, value := range r.URL.Query()["id"] {
+		listID, err := strconv.Atoi(value)
+		if err != nil || seen[listID] {
+			continue
+		}
+		seen[listID] = true
+		listIDs = append(listIDs, listID)
+	}
+
+	if len(listIDs) == 0 || len(listIDs) > maxFollowedLists {
+		http.Error(w, "Choose between 1 and "+strconv.Itoa(maxFollowedLists)+" lists", http.StatusBadRequest)
+		return
+	}
+
+	// Only follow lists the user can see
+	listRepo := list_repository.NewListRepository(db)
+	allowed, err := listRepo.AccessibleListIDs(user.ID, listIDs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(allowed) != len(listIDs) {
+		http.NotFound(w, r)
+		return
+	}
+
+	lastEventID, _ := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+
+	sub, err := broker.Subscribe(listIDs, lastEventID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Stop nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if sub.Reset {
+		fmt.Fprintf(w, "event: %s\ndata: {}\n\n", event_service.Reset)
+	}
+	for _, event := range sub.Replay {
+		writeEvent(w, event)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	accessCheck := time.NewTicker(accessCheckInterval)
+	defer accessCheck.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.Events:
+			if !ok {
+				// Dropped by the broker, the browser reconnects and replays
+				return
+			}
+			writeEvent(w, event)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-accessCheck.C:
+			// Members removed from a list or lists deleted meanwhile end the stream, the
+			// page reloads without them and reconnects with the lists it still shows
+			allowed, err := listRepo.AccessibleListIDs(user.ID, listIDs)
+			if err != nil {
+				log.Printf("failed to check the lists followed by user %d: %v", user.ID, err)
+				continue
+			}
+			if len(allowed) != len(listIDs) {
+				fmt.Fprintf(w, "event: %s\ndata: {}\n\n", event_service.Reset)
+				flusher.Flush()
+				return
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event event_service.Event) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+}
+
+// Tell the open browsers about a change. A failure only delays their update, so it is logged.
+func publish(broker event_service.Broker, listID int, eventType string, data interface{}) {
+	err := broker.Publish(listID, eventType, data)
+	if err != nil {
+		log.Printf("failed to publish %s event for list %d: %v", eventType, listID, err)
+	}
+}
+
+func publishProduct(broker event_service.Broker, listID int, eventType string, product product_repository.Product) {
+	publish(broker, listID, eventType, productEventData{
+		ListID: listID,
+		Product: productPayload{
+			ID:        product.ID,
+			Product:   product.Product,
+			Quantity:  product.Quantity,
+			Store:     product.Store,
+			Purchased: product.Purchased,
+		},
+	})
+}
@@ -0,0 +1,91 @@
+package list_handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Akhanrok/go_labs/repositories/list_repository"
+	"github.com/Akhanrok/go_labs/repositories/product_repository"
+	"github.com/Akhanrok/go_labs/services"
+	"github.com/Akhanrok/go_labs/services/session_service"
+)
+
+// A change that was rejected because someone else saved first. The edit page shows it
+// next to the saved state, so the user can submit it again or keep what is saved.
+type listConflict struct {
+	// Form action that submits the change again
+	Action string
+	// Name the user tried to give the list
+	Name string
+	// Product as the user submitted it and as it is saved now
+	Product product_repository.Product
+	Current product_repository.Product
+}
+
+func (c listConflict) IsProductChange() bool {
+	return c.Action == "/update-product" || c.Action == "/remove-product"
+}
+
+// Read the version the form was loaded with. Forms without one change the version the
+// handler just loaded, clients guard those with If-Match.
+func formVersion(r *http.Request, loaded int) int {
+	version, err := strconv.Atoi(r.PostForm.Get("version"))
+	if err != nil {
+		return loaded
+	}
+	return version
+}
+
+// Check an If-Match header against the ETag of the list, a missing header matches
+func matchesETag(ifMatch, etag string) bool {
+	if ifMatch == "" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload the list and show the rejected change with 409 Conflict
+func renderConflict(w http.ResponseWriter, r *http.Request, db *sql.DB, listID int, conflict listConflict) {
+	user, _ := session_service.UserFromContext(r.Context())
+
+	list, err := list_repository.NewListRepository(db).GetList(user.ID, listID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		http.Error(w, "The list has been deleted", http.StatusConflict)
+		return
+	}
+
+	errorMessage := ""
+	shown := &conflict
+	if conflict.IsProductChange() {
+		var ok bool
+		conflict.Current, ok = findProduct(list, conflict.Product.ID)
+		if !ok {
+			errorMessage = "The product has been removed by someone else"
+			shown = nil
+		}
+	}
+
+	// The status can only be written once the page is sure to render
+	data, err := loadEditListPage(db, list, errorMessage, shown)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", list.ETag())
+	w.WriteHeader(http.StatusConflict)
+	services.RenderTemplate(w, r, "edit-list.html", data)
+}
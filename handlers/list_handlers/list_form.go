@@ -0,0 +1,139 @@
+package list_handlers
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Akhanrok/go_labs/repositories/list_template_repository"
+	"github.com/Akhanrok/go_labs/repositories/product_repository"
+)
+
+const (
+	// Names are stored in VARCHAR(255) columns
+	maxNameLength = 255
+	maxQuantity   = 100000
+	// Keeps the multi-row insert well below the placeholder limit of MySQL
+	maxProducts = 500
+)
+
+// A product row of the list forms as the user typed it, with an error message per field
+type productRow struct {
+	Product       string
+	Quantity      string
+	Store         string
+	ProductError  string
+	QuantityError string
+	StoreError    string
+}
+
+// The create list form as the user typed it, rendered again when it is invalid
+type listForm struct {
+	ListName      string
+	ListNameError string
+	Rows          []productRow
+	ErrorMessage  string
+	// Templates of the user to start the list from, and the one the rows came from
+	Templates    []list_template_repository.Template
+	TemplateName string
+}
+
+// Fill the rows with the items of a template, the user removes the ones not needed this time
+func (f *listForm) fromTemplate(template *list_template_repository.Template) {
+	f.TemplateName = template.Name
+	f.Rows = nil
+	for _, item := range template.Items {
+		f.Rows = append(f.Rows, productRow{Product: item.Product, Quantity: strconv.Itoa(item.Quantity), Store: item.Store})
+	}
+}
+
+func (f *listForm) hasErrors() bool {
+	if f.ListNameError != "" || f.ErrorMessage != "" {
+		return true
+	}
+	for _, row := range f.Rows {
+		if row.ProductError != "" || row.QuantityError != "" || row.StoreError != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Read and validate the create list form. The product arrays are padded to the same
+// length so a tampered form is reported instead of indexing past the end.
+func parseListForm(values map[string][]string) (*listForm, []product_repository.Product) {
+	form := &listForm{ListName: strings.TrimSpace(first(values["listName"]))}
+	form.ListNameError = validateName(form.ListName, "List name")
+
+	names := values["product[]"]
+	quantities := values["quantity[]"]
+	stores := values["store[]"]
+
+	count := len(names)
+	if len(quantities) != count || len(stores) != count {
+		form.ErrorMessage = "Every product needs a name, quantity and store"
+		if len(quantities) > count {
+			count = len(quantities)
+		}
+		if len(stores) > count {
+			count = len(stores)
+		}
+	}
+
+	if count == 0 {
+		form.ErrorMessage = "Add at least one product"
+	}
+	if count > maxProducts {
+		form.ErrorMessage = "A list can have at most " + strconv.Itoa(maxProducts) + " products"
+		count = maxProducts
+	}
+
+	var products []product_repository.Product
+	for i := 0; i < count; i++ {
+		row := productRow{
+			Product:  strings.TrimSpace(at(names, i)),
+			Quantity: strings.TrimSpace(at(quantities, i)),
+			Store:    strings.TrimSpace(at(stores, i)),
+		}
+		product := validateProductRow(&row)
+
+		form.Rows = append(form.Rows, row)
+		products = append(products, product)
+	}
+
+	return form, products
+}
+
+// Validate the fields of one product row, setting the error messages on the row
+func validateProductRow(row *productRow) product_repository.Product {
+	row.ProductError = validateName(row.Product, "Product")
+	row.StoreError = validateName(row.Store, "Store")
+
+	quantity, err := strconv.Atoi(row.Quantity)
+	if err != nil || quantity < 1 || quantity > maxQuantity {
+		row.QuantityError = "Quantity should be a number from 1 to " + strconv.Itoa(maxQuantity)
+	}
+
+	return product_repository.Product{Product: row.Product, Quantity: quantity, Store: row.Store}
+}
+
+func validateName(value, field string) string {
+	if value == "" {
+		return field + " is required"
+	}
+	if utf8.RuneCountInString(value) > maxNameLength {
+		return field + " should be at most " + strconv.Itoa(maxNameLength) + " characters long"
+	}
+	return ""
+}
+
+func first(values []string) string {
+	return at(values, 0)
+}
+
+func at(values []string, i int) string {
+	if i < len(values) {
+		return values[i]
+	}
+	return ""
+}
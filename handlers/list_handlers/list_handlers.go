@@ -1,125 +1,212 @@
-package list_handlers
-
-import (
-	"database/sql"
-	"fmt"
-	"net/http"
-
-	"github.com/Akhanrok/go_labs/repositories/list_repository"
-	"github.com/Akhanrok/go_labs/services"
-	"github.com/gorilla/sessions"
-)
-
-func CreateListHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store) {
-	if r.Method == http.MethodPost {
-		session, err := store.Get(r, "session-name")
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		userID := session.Values["userID"].(int) // Get the user ID from the session
-
-		err = r.ParseForm()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		listName := r.PostForm.Get("listName")
-
-		// Create instances of the repositories
-		listRepo := list_repository.NewListRepository(db)
-
-		// Check if the list name already exists for the user in the database
-		listExists, err := listRepo.IsListExists(userID, listName)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		if listExists {
-			data := struct {
-				ErrorMessage string
-			}{
-				ErrorMessage: "The list with such name already exists",
-			}
-			services.RenderTemplate(w, "create-list.html", data)
-			return
-		}
-
-		// Insert the new list into the database
-		insertListQuery := "INSERT INTO lists (user_id, name) VALUES (?, ?)"
-		res, err := db.Exec(insertListQuery, userID, listName)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		listID, _ := res.LastInsertId()
-
-		// Get the product, quantity, and store values from the form
-		products := r.PostForm["product[]"]
-		quantities := r.PostForm["quantity[]"]
-		stores := r.PostForm["store[]"]
-
-		// Insert each product into the database
-		insertProductQuery := "INSERT INTO products (list_id, name, quantity, store) VALUES (?, ?, ?, ?)"
-		for i := range products {
-			_, err = db.Exec(insertProductQuery, listID, products[i], quantities[i], stores[i])
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-
-		// Redirect to the list success page
-		http.Redirect(w, r, fmt.Sprintf("/list-success?name=%s", listName), http.StatusFound)
-		return
-	}
-
-	services.RenderTemplate(w, "create-list.html", nil)
-}
-
-func ListSuccessHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		listName := r.URL.Query().Get("name")
-		data := struct {
-			ListName string
-		}{
-			ListName: listName,
-		}
-		services.RenderTemplate(w, "list-success.html", data)
-	}
-}
-
-func ViewListsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store) {
-	if r.Method == http.MethodGet {
-		// Get the user ID of the currently authenticated user from the session
-		session, err := store.Get(r, "session-name")
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		userID := session.Values["userID"].(int)
-
-		// Create an instance of the ListRepository
-		listRepo := list_repository.NewListRepository(db)
-
-		// Retrieve the list names and items for the user from the database
-		lists, err := listRepo.GetListsData(userID)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		data := struct {
-			Lists []list_repository.ListData
-		}{
-			Lists: lists,
-		}
-
-		services.RenderTemplate(w, "view-lists.html", data)
-	}
-}
+package list_handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/Akhanrok/go_labs/repositories/list_repository"
+	"github.com/Akhanrok/go_labs/repositories/list_template_repository"
+	"github.com/Akhanrok/go_labs/services"
+	"github.com/Akhanrok/go_labs/services/session_service"
+)
+
+func CreateListHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method == http.MethodPost {
+		// Get the user put in the request context by the auth middleware
+		user, ok := session_service.UserFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+		userID := user.ID
+
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Validate the list name and every product row, keeping the input for the form
+		form, products := parseListForm(r.PostForm)
+
+		// Create instances of the repositories
+		listRepo := list_repository.NewListRepository(db)
+
+		if form.ListNameError == "" {
+			// Check if the list name already exists for the user in the database
+			listExists, err := listRepo.IsListExists(userID, form.ListName)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			if listExists {
+				form.ListNameError = "The list with such name already exists"
+			}
+		}
+
+		if form.hasErrors() {
+			// The template picker stays on the form shown again
+			err = loadFormTemplates(db, userID, form)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			services.RenderTemplate(w, r, "create-list.html", form)
+			return
+		}
+
+		// Insert the new list with its products into the database
+		_, err = listRepo.CreateList(userID, form.ListName, products)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Redirect to the list success page
+		http.Redirect(w, r, "/list-success?name="+url.QueryEscape(form.ListName), http.StatusFound)
+		return
+	}
+
+	user, ok := session_service.UserFromContext(r.Context())
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	// Start with one empty product row
+	form := &listForm{Rows: []productRow{{Quantity: "1"}}}
+
+	err := loadFormTemplates(db, user.ID, form)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if value := r.URL.Query().Get("template"); value != "" {
+		templateID, _ := strconv.Atoi(value)
+		template, err := list_template_repository.NewListTemplateRepository(db).GetTemplate(user.ID, templateID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if template == nil {
+			http.NotFound(w, r)
+			return
+		}
+		form.fromTemplate(template)
+	}
+
+	services.RenderTemplate(w, r, "create-list.html", form)
+}
+
+// Fill in the templates the user can start the list from
+func loadFormTemplates(db *sql.DB, userID int, form *listForm) error {
+	templates, err := list_template_repository.NewListTemplateRepository(db).GetTemplates(userID)
+	if err != nil {
+		return err
+	}
+	form.Templates = templates
+	return nil
+}
+
+func ListSuccessHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		listName := r.URL.Query().Get("name")
+		data := struct {
+			ListName string
+		}{
+			ListName: listName,
+		}
+		services.RenderTemplate(w, r, "list-success.html", data)
+	}
+}
+
+type listSort struct {
+	Value string
+	Label string
+}
+
+// Sort orders offered on the lists page
+var listSorts = []listSort{
+	{list_repository.SortCreated, "Oldest first"},
+	{"-" + list_repository.SortCreated, "Newest first"},
+	{list_repository.SortName, "Name (A-Z)"},
+	{"-" + list_repository.SortName, "Name (Z-A)"},
+	{"-" + list_repository.SortItems, "Most products"},
+	{list_repository.SortItems, "Fewest products"},
+}
+
+func ViewListsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method == http.MethodGet {
+		// Get the user put in the request context by the auth middleware
+		user, ok := session_service.UserFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+		userID := user.ID
+
+		// Active and archived lists are paged separately, the oldest lists come first by default
+		query := list_repository.ListsQuery{
+			Sort:     r.URL.Query().Get("sort"),
+			Archived: r.URL.Query().Get("archived") == "true",
+			Cursor:   r.URL.Query().Get("after"),
+		}
+		if query.Sort == "" {
+			query.Sort = list_repository.SortCreated
+		}
+
+		// Create an instance of the ListRepository
+		listRepo := list_repository.NewListRepository(db)
+
+		// Retrieve a page of the lists and their items for the user from the database
+		page, err := listRepo.GetListsPage(userID, query)
+		if err == list_repository.ErrInvalidSort || err == list_repository.ErrInvalidCursor {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := struct {
+			Lists    []list_repository.ListData
+			Archived bool
+			Sort     string
+			Sorts    []listSort
+			// Links to the first page when paging, and to the next page unless this is the last one
+			FirstURL string
+			NextURL  string
+		}{
+			Lists:    page.Lists,
+			Archived: query.Archived,
+			Sort:     query.Sort,
+			Sorts:    listSorts,
+		}
+		if query.Cursor != "" {
+			data.FirstURL = listsURL(query, "")
+		}
+		if page.Next != "" {
+			data.NextURL = listsURL(query, page.Next)
+		}
+
+		services.RenderTemplate(w, r, "view-lists.html", data)
+	}
+}
+
+// Link to a page of the lists with the same sort order
+func listsURL(query list_repository.ListsQuery, cursor string) string {
+	values := url.Values{"sort": {query.Sort}}
+	if query.Archived {
+		values.Set("archived", "true")
+	}
+	if cursor != "" {
+		values.Set("after", cursor)
+	}
+	return "/view-lists?" + values.Encode()
+}
@@ -0,0 +1,210 @@
+package list_handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Akhanrok/go_labs/repositories/list_member_repository"
+	"github.com/Akhanrok/go_labs/repositories/list_schedule_repository"
+	"github.com/Akhanrok/go_labs/services"
+	"github.com/Akhanrok/go_labs/services/schedule_service"
+	"github.com/Akhanrok/go_labs/services/session_service"
+	"github.com/gorilla/sessions"
+)
+
+// Upcoming occurrences shown for every schedule
+const upcomingOccurrences = 3
+
+// A schedule with its rule read for the forms and the next days a list is generated
+type scheduleView struct {
+	list_schedule_repository.Schedule
+	ParsedRule schedule_service.Rule
+	Upcoming   []time.Time
+}
+
+func newScheduleView(schedule list_schedule_repository.Schedule) (scheduleView, error) {
+	rule, err := schedule_service.ParseRule(schedule.Rule)
+	if err != nil {
+		return scheduleView{}, err
+	}
+
+	// The stored next run is the first upcoming day, it may be overdue by a minute
+	next := schedule.NextRunAt.In(schedule_service.Location())
+	upcoming := append([]time.Time{next}, rule.Upcoming(schedule_service.Start(schedule.StartsOn), next, upcomingOccurrences-1)...)
+
+	return scheduleView{Schedule: schedule, ParsedRule: rule, Upcoming: upcoming}, nil
+}
+
+// Make the list recur, or change how it recurs
+func SetListScheduleHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, ok := accessibleList(w, r, db, list_member_repository.RoleOwner)
+	if !ok {
+		return
+	}
+
+	rule, start, errorMessage := parseScheduleForm(r)
+	if errorMessage != "" {
+		renderEditList(w, r, db, list, errorMessage)
+		return
+	}
+
+	next := rule.Next(start, time.Now())
+
+	err := list_schedule_repository.NewListScheduleRepository(db).SetSchedule(list.ID, rule.String(), start, r.PostForm.Get("carryOver") == "on", next)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	redirectToList(w, r, store, list.ID, fmt.Sprintf("%s will be created %s, first on %s",
+		list.ListName, rule.Describe(), next.Format("Monday, 2006-01-02")))
+}
+
+func RemoveListScheduleHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, ok := accessibleList(w, r, db, list_member_repository.RoleOwner)
+	if !ok {
+		return
+	}
+
+	err := list_schedule_repository.NewListScheduleRepository(db).RemoveSchedule(list.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	redirectToList(w, r, store, list.ID, "The list will not be created again")
+}
+
+// Show the recurring lists of the user with the days the next lists are generated
+func ListSchedulesHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := session_service.UserFromContext(r.Context())
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	schedules, err := list_schedule_repository.NewListScheduleRepository(db).GetSchedules(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Schedules []scheduleView
+	}{}
+	for _, schedule := range schedules {
+		view, err := newScheduleView(schedule)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data.Schedules = append(data.Schedules, view)
+	}
+
+	services.RenderTemplate(w, r, "list-schedules.html", data)
+}
+
+// Read the rule and the first day of the schedule form, the error message is empty when they are valid
+func parseScheduleForm(r *http.Request) (schedule_service.Rule, time.Time, string) {
+	rule := schedule_service.Rule{Frequency: r.PostForm.Get("frequency")}
+
+	var err error
+	rule.Interval, err = strconv.Atoi(r.PostForm.Get("interval"))
+	if err != nil {
+		return rule, time.Time{}, "The interval should be a number"
+	}
+
+	if rule.Frequency == schedule_service.Weekly {
+		weekday, err := strconv.Atoi(r.PostForm.Get("weekday"))
+		if err != nil {
+			return rule, time.Time{}, "Choose a day of the week"
+		}
+		rule.Weekday = time.Weekday(weekday)
+	} else {
+		rule.MonthDay, err = strconv.Atoi(r.PostForm.Get("monthDay"))
+		if err != nil {
+			return rule, time.Time{}, "Choose a day of the month"
+		}
+	}
+
+	if err := rule.Validate(); err != nil {
+		return rule, time.Time{}, "Invalid schedule: " + err.Error()
+	}
+
+	// Without a start the schedule counts from today
+	start := schedule_service.Start(time.Now().In(schedule_service.Location()))
+	if value := r.PostForm.Get("startsOn"); value != "" {
+		day, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return rule, time.Time{}, "The start should be a date"
+		}
+		start = schedule_service.Start(day)
+	}
+
+	return rule, start, ""
+}
+
+// The schedule form of the edit page, filled with the current schedule when the list recurs
+type scheduleForm struct {
+	Current *scheduleView
+	Rule    schedule_service.Rule
+	// StartsOn is the first day in the form of a date input
+	StartsOn  string
+	CarryOver bool
+}
+
+func loadScheduleForm(db *sql.DB, listID int) (*scheduleForm, error) {
+	schedule, err := list_schedule_repository.NewListScheduleRepository(db).GetSchedule(listID)
+	if err != nil {
+		return nil, err
+	}
+
+	// New schedules default to every week, starting today
+	form := &scheduleForm{
+		Rule:     schedule_service.Rule{Frequency: schedule_service.Weekly, Interval: 1, Weekday: time.Saturday, MonthDay: 1},
+		StartsOn: time.Now().In(schedule_service.Location()).Format("2006-01-02"),
+	}
+	if schedule == nil {
+		return form, nil
+	}
+
+	view, err := newScheduleView(*schedule)
+	if err != nil {
+		return nil, err
+	}
+	form.Current = &view
+	form.Rule = view.ParsedRule
+	form.StartsOn = schedule.StartsOn.Format("2006-01-02")
+	form.CarryOver = schedule.CarryOver
+	return form, nil
+}
+
+func (scheduleForm) Weekdays() []time.Weekday {
+	return []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday}
+}
+
+func (scheduleForm) MonthDays() []int {
+	days := make([]int, 31)
+	for i := range days {
+		days[i] = i + 1
+	}
+	return days
+}
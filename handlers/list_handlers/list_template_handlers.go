@@ -0,0 +1,167 @@
+package list_handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Akhanrok/go_labs/repositories/list_member_repository"
+	"github.com/Akhanrok/go_labs/repositories/list_repository"
+	"github.com/Akhanrok/go_labs/repositories/list_template_repository"
+	"github.com/Akhanrok/go_labs/services"
+	"github.com/Akhanrok/go_labs/services/session_service"
+	"github.com/gorilla/sessions"
+)
+
+// Save the products of a list the user can see as one of their templates
+func SaveListTemplateHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, ok := accessibleList(w, r, db, list_member_repository.RoleViewer)
+	if !ok {
+		return
+	}
+	user, _ := session_service.UserFromContext(r.Context())
+
+	name := strings.TrimSpace(r.PostForm.Get("templateName"))
+	if message := validateName(name, "Template name"); message != "" {
+		renderEditList(w, r, db, list, message)
+		return
+	}
+
+	if len(list.Products) == 0 {
+		renderEditList(w, r, db, list, "Add products to the list before saving it as a template")
+		return
+	}
+
+	templateRepo := list_template_repository.NewListTemplateRepository(db)
+
+	templateExists, err := templateRepo.IsTemplateExists(user.ID, name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if templateExists {
+		renderEditList(w, r, db, list, "The template with such name already exists")
+		return
+	}
+
+	_, err = templateRepo.CreateTemplate(user.ID, name, list.Products)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	redirectToTemplates(w, r, store, fmt.Sprintf("%s has been saved as a template", name))
+}
+
+func ListTemplatesHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := session_service.UserFromContext(r.Context())
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	templates, err := list_template_repository.NewListTemplateRepository(db).GetTemplates(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Templates []list_template_repository.Template
+	}{
+		Templates: templates,
+	}
+	services.RenderTemplate(w, r, "list-templates.html", data)
+}
+
+func DeleteListTemplateHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := session_service.UserFromContext(r.Context())
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	templateID, err := strconv.Atoi(r.PostFormValue("templateId"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = list_template_repository.NewListTemplateRepository(db).DeleteTemplate(user.ID, templateID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	redirectToTemplates(w, r, store, "The template has been deleted")
+}
+
+// Copy a list the user can see, with all its products, into a new list of the user
+func DuplicateListHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, ok := accessibleList(w, r, db, list_member_repository.RoleViewer)
+	if !ok {
+		return
+	}
+	user, _ := session_service.UserFromContext(r.Context())
+
+	name := strings.TrimSpace(r.PostForm.Get("listName"))
+	if message := validateName(name, "List name"); message != "" {
+		renderEditList(w, r, db, list, message)
+		return
+	}
+
+	listRepo := list_repository.NewListRepository(db)
+
+	listExists, err := listRepo.IsListExists(user.ID, name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if listExists {
+		renderEditList(w, r, db, list, "The list with such name already exists")
+		return
+	}
+
+	// The copy starts with nothing purchased
+	listID, err := listRepo.CreateList(user.ID, name, list.Products)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	redirectToList(w, r, store, listID, fmt.Sprintf("%s has been created as a copy of %s", name, list.ListName))
+}
+
+func redirectToTemplates(w http.ResponseWriter, r *http.Request, store sessions.Store, message string) {
+	err := session_service.AddFlash(w, r, store, session_service.FlashInfo, message)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/list-templates", http.StatusFound)
+}
@@ -0,0 +1,157 @@
+package list_handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Akhanrok/go_labs/repositories/list_repository"
+	"github.com/Akhanrok/go_labs/services"
+	"github.com/Akhanrok/go_labs/services/event_service"
+	"github.com/Akhanrok/go_labs/services/merge_service"
+	"github.com/Akhanrok/go_labs/services/session_service"
+	"github.com/gorilla/sessions"
+)
+
+// The merge form as the user filled it in, rendered again with the conflicts to resolve
+type mergeForm struct {
+	Lists         []list_repository.ListData
+	Selected      map[int]bool
+	Name          string
+	NameError     string
+	DeleteSources bool
+	ErrorMessage  string
+	// Products with different stores, the store chosen for each of them so far
+	// and the ETags of the lists the conflicts were found in
+	Conflicts    []merge_service.Conflict
+	Resolutions  map[string]string
+	ETags        map[int]string
+	KeepSeparate string
+}
+
+// Merge two or more lists into a new one. Products found in several lists are added
+// together, products with different stores are shown to the user to pick the store,
+// and the merged lists the user owns can be moved to the trash.
+func MergeListsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store, broker event_service.Broker) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, _ := session_service.UserFromContext(r.Context())
+	listRepo := list_repository.NewListRepository(db)
+
+	lists, err := listRepo.GetListsData(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	form := &mergeForm{
+		Lists:         lists,
+		Selected:      map[int]bool{},
+		Name:          strings.TrimSpace(r.Form.Get("listName")),
+		DeleteSources: r.Form.Get("deleteSources") == "on",
+		Resolutions:   map[string]string{},
+		ETags:         map[int]string{},
+		KeepSeparate:  merge_service.KeepSeparate,
+	}
+	for _, value := range r.Form["list"] {
+		if id, err := strconv.Atoi(value); err == nil {
+			form.Selected[id] = true
+		}
+	}
+
+	// The edit page links here with the list to start from
+	if r.Method == http.MethodGet {
+		services.RenderTemplate(w, r, "merge-lists.html", form)
+		return
+	}
+
+	var sources []list_repository.ListData
+	for _, list := range lists {
+		if form.Selected[list.ID] {
+			sources = append(sources, list)
+		}
+	}
+	if len(sources) < 2 {
+		form.ErrorMessage = "Choose at least two lists to merge"
+	}
+
+	form.NameError = validateName(form.Name, "List name")
+	if form.NameError == "" {
+		listExists, err := listRepo.IsListExists(user.ID, form.Name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if listExists {
+			form.NameError = "The list with such name already exists"
+		}
+	}
+
+	// Conflicts are resolved for the lists as the user saw them, if one of them
+	// changed meanwhile the products are merged again and shown for another look
+	for _, list := range sources {
+		form.ETags[list.ID] = list.ETag()
+		if etag := r.PostForm.Get("etag-" + strconv.Itoa(list.ID)); etag != "" && etag != list.ETag() {
+			form.ErrorMessage = fmt.Sprintf("%s has been changed meanwhile, check the merge again", list.ListName)
+		}
+	}
+
+	for key, values := range r.PostForm {
+		if strings.HasPrefix(key, "resolve-") && len(values) > 0 {
+			form.Resolutions[strings.TrimPrefix(key, "resolve-")] = values[0]
+		}
+	}
+
+	products, conflicts := merge_service.Merge(sources, form.Resolutions)
+	form.Conflicts = conflicts
+	if len(products) > maxProducts {
+		form.ErrorMessage = "A list can have at most " + strconv.Itoa(maxProducts) + " products"
+	}
+
+	if form.ErrorMessage != "" || form.NameError != "" || len(form.Conflicts) > 0 {
+		services.RenderTemplate(w, r, "merge-lists.html", form)
+		return
+	}
+
+	listID, err := listRepo.MergeLists(user.ID, list_repository.Merge{
+		Name:          form.Name,
+		Products:      products,
+		Sources:       form.ETags,
+		DeleteSources: form.DeleteSources,
+	})
+	if err == list_repository.ErrVersionConflict {
+		form.ErrorMessage = "One of the lists has been changed meanwhile, check the merge again"
+		services.RenderTemplate(w, r, "merge-lists.html", form)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	message := fmt.Sprintf("%s has been created from %d lists", form.Name, len(sources))
+	if form.DeleteSources {
+		trashed := 0
+		for _, list := range sources {
+			if list.IsShared() {
+				continue
+			}
+			publish(broker, list.ID, event_service.ListDeleted, listEventData{ListID: list.ID, Archived: list.Archived})
+			trashed++
+		}
+		message += fmt.Sprintf(", %d of them moved to the trash", trashed)
+	}
+
+	redirectToList(w, r, store, listID, message)
+}
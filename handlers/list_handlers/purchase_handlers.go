@@ -0,0 +1,157 @@
+package list_handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Akhanrok/go_labs/repositories/list_member_repository"
+	"github.com/Akhanrok/go_labs/repositories/list_repository"
+	"github.com/Akhanrok/go_labs/repositories/product_repository"
+	"github.com/Akhanrok/go_labs/services/event_service"
+	"github.com/Akhanrok/go_labs/services/session_service"
+	"github.com/gorilla/sessions"
+)
+
+// Progress of a list returned by the toggle endpoint
+type listProgress struct {
+	Purchased bool `json:"purchased"`
+	Done      int  `json:"done"`
+	Total     int  `json:"total"`
+	Archived  bool `json:"archived"`
+}
+
+// Check a product off or put it back. Scripts asking for JSON get the new progress
+// of the list, plain form posts are redirected back to the lists.
+func TogglePurchasedHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, broker event_service.Broker) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, ok := accessibleList(w, r, db, list_member_repository.RoleEditor)
+	if !ok {
+		return
+	}
+
+	productID, _ := strconv.Atoi(r.PostForm.Get("productId"))
+	product, ok := findProduct(list, productID)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	purchased := r.PostForm.Get("purchased") == "true"
+
+	err := markPurchased(db, broker, list, product, purchased)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !strings.Contains(r.Header.Get("Accept"), "application/json") {
+		http.Redirect(w, r, "/view-lists", http.StatusFound)
+		return
+	}
+
+	user, _ := session_service.UserFromContext(r.Context())
+	list, err = list_repository.NewListRepository(db).GetList(user.ID, list.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", list.ETag())
+	json.NewEncoder(w).Encode(listProgress{
+		Purchased: purchased,
+		Done:      list.PurchasedCount(),
+		Total:     len(list.Products),
+		Archived:  list.Archived,
+	})
+}
+
+func SetAutoArchiveHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store, broker event_service.Broker) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, ok := accessibleList(w, r, db, list_member_repository.RoleOwner)
+	if !ok {
+		return
+	}
+	user, _ := session_service.UserFromContext(r.Context())
+
+	enabled := r.PostForm.Get("autoArchive") == "on"
+
+	listRepo := list_repository.NewListRepository(db)
+	err := listRepo.SetAutoArchive(user.ID, list.ID, enabled, formVersion(r, list.Version))
+	if err == list_repository.ErrVersionConflict {
+		renderConflict(w, r, db, list.ID, listConflict{Action: "/set-auto-archive"})
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	message := "The list will stay active when everything is purchased"
+	if enabled {
+		// The list may already be done
+		archived, err := listRepo.ArchiveIfDone(list.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if archived {
+			publish(broker, list.ID, event_service.ListArchived, listEventData{ListID: list.ID, Archived: true})
+		}
+		message = "The list will be archived when everything is purchased"
+	}
+
+	redirectToList(w, r, store, list.ID, message)
+}
+
+// Check the product off or put it back and tell the open pages. Checking the last
+// product archives the list, unchecking one brings it back.
+func markPurchased(db *sql.DB, broker event_service.Broker, list *list_repository.ListData, product product_repository.Product, purchased bool) error {
+	err := product_repository.NewProductRepository(db).SetPurchased(list.ID, product.ID, purchased)
+	if err != nil {
+		return err
+	}
+
+	listRepo := list_repository.NewListRepository(db)
+	archived := list.Archived
+	if purchased {
+		var justArchived bool
+		justArchived, err = listRepo.ArchiveIfDone(list.ID)
+		archived = archived || justArchived
+	} else {
+		err = listRepo.Unarchive(list.ID)
+		archived = false
+	}
+	if err != nil {
+		return err
+	}
+
+	product.Purchased = purchased
+	publishProduct(broker, list.ID, event_service.ProductUpdated, product)
+	if archived != list.Archived {
+		publish(broker, list.ID, event_service.ListArchived, listEventData{ListID: list.ID, Archived: archived})
+	}
+	list.Archived = archived
+	return nil
+}
+
+// Find the product in the products of the list
+func findProduct(list *list_repository.ListData, productID int) (product_repository.Product, bool) {
+	for _, product := range list.Products {
+		if product.ID == productID {
+			return product, true
+		}
+	}
+	return product_repository.Product{}, false
+}
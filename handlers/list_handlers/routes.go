@@ -0,0 +1,65 @@
+package list_handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/Akhanrok/go_labs/config"
+	"github.com/Akhanrok/go_labs/handlers/middleware"
+	"github.com/Akhanrok/go_labs/repositories/user_repository"
+	"github.com/Akhanrok/go_labs/services/event_service"
+	"github.com/Akhanrok/go_labs/services/mail_service"
+	"github.com/gorilla/sessions"
+)
+
+// Route is a page or action on lists that needs a logged in user
+type Route struct {
+	Path    string
+	Handler http.HandlerFunc
+}
+
+// Return the list routes, they are registered with RegisterRoutes
+func Routes(db *sql.DB, store sessions.Store, broker event_service.Broker, mailer mail_service.Mailer, cfg *config.Config) []Route {
+	return []Route{
+		{"/create-list", func(w http.ResponseWriter, r *http.Request) { CreateListHandler(w, r, db) }},
+		{"/edit-list", func(w http.ResponseWriter, r *http.Request) { EditListHandler(w, r, db) }},
+		{"/rename-list", func(w http.ResponseWriter, r *http.Request) { RenameListHandler(w, r, db, store, broker) }},
+		{"/add-product", func(w http.ResponseWriter, r *http.Request) { AddProductHandler(w, r, db, store, broker) }},
+		{"/update-product", func(w http.ResponseWriter, r *http.Request) { UpdateProductHandler(w, r, db, store, broker) }},
+		{"/remove-product", func(w http.ResponseWriter, r *http.Request) { RemoveProductHandler(w, r, db, store, broker) }},
+		{"/toggle-product", func(w http.ResponseWriter, r *http.Request) { TogglePurchasedHandler(w, r, db, broker) }},
+		{"/duplicate-list", func(w http.ResponseWriter, r *http.Request) { DuplicateListHandler(w, r, db, store) }},
+		{"/merge-lists", func(w http.ResponseWriter, r *http.Request) { MergeListsHandler(w, r, db, store, broker) }},
+		{"/save-list-template", func(w http.ResponseWriter, r *http.Request) { SaveListTemplateHandler(w, r, db, store) }},
+		{"/list-templates", func(w http.ResponseWriter, r *http.Request) { ListTemplatesHandler(w, r, db) }},
+		{"/delete-list-template", func(w http.ResponseWriter, r *http.Request) { DeleteListTemplateHandler(w, r, db, store) }},
+		{"/set-list-schedule", func(w http.ResponseWriter, r *http.Request) { SetListScheduleHandler(w, r, db, store) }},
+		{"/remove-list-schedule", func(w http.ResponseWriter, r *http.Request) { RemoveListScheduleHandler(w, r, db, store) }},
+		{"/list-schedules", func(w http.ResponseWriter, r *http.Request) { ListSchedulesHandler(w, r, db) }},
+		{"/list-events", func(w http.ResponseWriter, r *http.Request) { ListEventsHandler(w, r, db, broker) }},
+		{"/shop-by-store", func(w http.ResponseWriter, r *http.Request) { ShopByStoreHandler(w, r, db) }},
+		{"/purchase-store-item", func(w http.ResponseWriter, r *http.Request) { PurchaseStoreItemHandler(w, r, db, store, broker) }},
+		{"/set-auto-archive", func(w http.ResponseWriter, r *http.Request) { SetAutoArchiveHandler(w, r, db, store, broker) }},
+		{"/share-list", func(w http.ResponseWriter, r *http.Request) { ShareListHandler(w, r, db, store, mailer, cfg) }},
+		{"/accept-invitation", func(w http.ResponseWriter, r *http.Request) { AcceptInvitationHandler(w, r, db, store) }},
+		{"/revoke-invitation", func(w http.ResponseWriter, r *http.Request) { RevokeInvitationHandler(w, r, db, store) }},
+		{"/remove-member", func(w http.ResponseWriter, r *http.Request) { RemoveMemberHandler(w, r, db, store) }},
+		{"/create-share-link", func(w http.ResponseWriter, r *http.Request) { CreateShareLinkHandler(w, r, db, cfg) }},
+		{"/revoke-share-link", func(w http.ResponseWriter, r *http.Request) { RevokeShareLinkHandler(w, r, db, store) }},
+		{"/delete-list", func(w http.ResponseWriter, r *http.Request) { DeleteListHandler(w, r, db, store, broker) }},
+		{"/trash", func(w http.ResponseWriter, r *http.Request) { TrashHandler(w, r, db, cfg.TrashRetentionDays) }},
+		{"/restore-list", func(w http.ResponseWriter, r *http.Request) { RestoreListHandler(w, r, db, store) }},
+		{"/purge-list", func(w http.ResponseWriter, r *http.Request) { PurgeListHandler(w, r, db, store) }},
+		{"/search", func(w http.ResponseWriter, r *http.Request) { SearchHandler(w, r, db) }},
+		{"/view-lists", func(w http.ResponseWriter, r *http.Request) { ViewListsHandler(w, r, db) }},
+	}
+}
+
+// Register the routes on the mux behind the same checks: every request needs a logged in user,
+// and every request that changes something needs a verified email once the grace period is over
+func RegisterRoutes(mux *http.ServeMux, routes []Route, store sessions.Store, users user_repository.UserRepository, gracePeriod time.Duration) {
+	for _, route := range routes {
+		mux.HandleFunc(route.Path, middleware.RequireAuth(store, middleware.RequireVerified(users, gracePeriod, route.Handler)))
+	}
+}
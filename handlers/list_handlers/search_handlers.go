@@ -0,0 +1,50 @@
+package list_handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/Akhanrok/go_labs/repositories/list_repository"
+	"github.com/Akhanrok/go_labs/services"
+	"github.com/Akhanrok/go_labs/services/search_service"
+	"github.com/Akhanrok/go_labs/services/session_service"
+)
+
+// Search the names of the lists the user can see and the names and stores of their products
+func SearchHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := session_service.UserFromContext(r.Context())
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	terms := search_service.Terms(query)
+
+	data := struct {
+		Query   string
+		Terms   []string
+		Results []list_repository.ListData
+	}{
+		Query: query,
+		Terms: terms,
+	}
+
+	if len(terms) > 0 {
+		results, err := list_repository.NewListRepository(db).Search(user.ID, terms)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		search_service.Rank(results, terms)
+		data.Results = results
+	}
+
+	services.RenderTemplate(w, r, "search.html", data)
+}
@@ -0,0 +1,256 @@
+package list_handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Akhanrok/go_labs/config"
+	"github.com/Akhanrok/go_labs/repositories/list_invitation_repository"
+	"github.com/Akhanrok/go_labs/repositories/list_member_repository"
+	"github.com/Akhanrok/go_labs/repositories/user_repository"
+	"github.com/Akhanrok/go_labs/services"
+	"github.com/Akhanrok/go_labs/services/mail_service"
+	"github.com/Akhanrok/go_labs/services/session_service"
+	"github.com/Akhanrok/go_labs/services/token_service"
+	"github.com/gorilla/sessions"
+)
+
+// Invitations to a list can be accepted for a week
+const invitationValidity = 7 * 24 * time.Hour
+
+// Invite someone to the list by email or change the role of a member. New people always
+// get an invitation, so the response does not tell whether the email has an account.
+func ShareListHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store, mailer mail_service.Mailer, cfg *config.Config) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, ok := accessibleList(w, r, db, list_member_repository.RoleOwner)
+	if !ok {
+		return
+	}
+
+	email := strings.TrimSpace(r.PostForm.Get("email"))
+	role := r.PostForm.Get("role")
+
+	if !list_member_repository.IsValidMemberRole(role) {
+		renderEditList(w, r, db, list, "Choose whether the user can view or edit the list")
+		return
+	}
+	if !services.IsValidEmail(email) {
+		renderEditList(w, r, db, list, "Enter a valid email address")
+		return
+	}
+
+	// The owner already sees the members of the list, for them only the role changes
+	memberRepo := list_member_repository.NewListMemberRepository(db)
+	members, err := memberRepo.GetMembers(list.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, member := range members {
+		if strings.EqualFold(member.Email, email) {
+			err = memberRepo.AddMember(list.ID, member.UserID, role)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			redirectToList(w, r, store, list.ID, fmt.Sprintf("%s can now %s the list", member.Name, roleAction(role)))
+			return
+		}
+	}
+
+	owner, err := user_repository.NewUserRepository(db).GetUserByID(list.OwnerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if owner != nil && strings.EqualFold(owner.Email, email) {
+		renderEditList(w, r, db, list, "You already own this list")
+		return
+	}
+
+	token, err := token_service.GenerateToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Only the hash of the token is stored, the link is only in the email
+	err = list_invitation_repository.NewListInvitationRepository(db).CreateInvitation(list.ID, email, role, token_service.HashToken(token), time.Now().Add(invitationValidity))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The names are typed by users, so they only go in the body and never in a header
+	msg := mail_service.Message{
+		To:      email,
+		Subject: "A shopping list was shared with you",
+		Body: fmt.Sprintf("Hello!\n\n%s invited you to %s the list \"%s\". Open this link to accept the invitation, "+
+			"if you don't have a ShoppingList account yet, register with this email address first:\n%s/accept-invitation?token=%s\n\n"+
+			"The link is valid for %d days.\n",
+			list.OwnerName, roleAction(role), list.ListName, cfg.BaseURL, url.QueryEscape(token), int(invitationValidity.Hours()/24)),
+	}
+	go func() {
+		if err := mailer.Send(msg); err != nil {
+			log.Printf("failed to send list invitation email: %v", err)
+		}
+	}()
+
+	redirectToList(w, r, store, list.ID, fmt.Sprintf("An invitation to %s the list has been sent to %s", roleAction(role), email))
+}
+
+// Show an invitation from an email and let the user with that email accept it
+func AcceptInvitationHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Keep the token out of Referer headers
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessionUser, _ := session_service.UserFromContext(r.Context())
+	user, err := user_repository.NewUserRepository(db).GetUserByID(sessionUser.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	token := r.Form.Get("token")
+	invitationRepo := list_invitation_repository.NewListInvitationRepository(db)
+	invitation, err := invitationRepo.GetInvitationByToken(token_service.HashToken(token))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Invitation   *list_invitation_repository.Invitation
+		Token        string
+		Action       string
+		ErrorMessage string
+	}{
+		Invitation: invitation,
+		Token:      token,
+	}
+
+	if invitation == nil {
+		w.WriteHeader(http.StatusNotFound)
+		services.RenderTemplate(w, r, "accept-invitation.html", data)
+		return
+	}
+	data.Action = roleAction(invitation.Role)
+
+	// The link was mailed to the address, the account with that address accepts it
+	if user == nil || !strings.EqualFold(user.Email, invitation.Email) {
+		data.ErrorMessage = fmt.Sprintf("This invitation was sent to %s, log in with the account of that email address to accept it.", invitation.Email)
+		w.WriteHeader(http.StatusForbidden)
+		services.RenderTemplate(w, r, "accept-invitation.html", data)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		services.RenderTemplate(w, r, "accept-invitation.html", data)
+		return
+	}
+
+	err = invitationRepo.AcceptInvitation(invitation, user.ID)
+	if err == sql.ErrNoRows {
+		http.Redirect(w, r, fmt.Sprintf("/edit-list?id=%d", invitation.ListID), http.StatusFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	redirectToList(w, r, store, invitation.ListID, fmt.Sprintf("You can now %s %s", data.Action, invitation.ListName))
+}
+
+func RevokeInvitationHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, ok := accessibleList(w, r, db, list_member_repository.RoleOwner)
+	if !ok {
+		return
+	}
+
+	invitationID, _ := strconv.Atoi(r.PostForm.Get("invitationId"))
+
+	err := list_invitation_repository.NewListInvitationRepository(db).RevokeInvitation(list.ID, invitationID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	redirectToList(w, r, store, list.ID, "The invitation has been revoked")
+}
+
+// Stop sharing the list with a member. Members may also remove themselves to leave a list.
+func RemoveMemberHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, ok := accessibleList(w, r, db, list_member_repository.RoleViewer)
+	if !ok {
+		return
+	}
+	user, _ := session_service.UserFromContext(r.Context())
+
+	memberID, _ := strconv.Atoi(r.PostForm.Get("userId"))
+	leaving := memberID == user.ID
+
+	if !leaving && !list.HasRole(list_member_repository.RoleOwner) {
+		http.Error(w, "You are not allowed to change this list", http.StatusForbidden)
+		return
+	}
+
+	err := list_member_repository.NewListMemberRepository(db).RemoveMember(list.ID, memberID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if leaving {
+		err = session_service.AddFlash(w, r, store, session_service.FlashInfo, fmt.Sprintf("You left %s", list.ListName))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/view-lists", http.StatusFound)
+		return
+	}
+
+	redirectToList(w, r, store, list.ID, "The list is no longer shared with this user")
+}
+
+// Describe what a member role allows, for messages
+func roleAction(role string) string {
+	if role == list_member_repository.RoleEditor {
+		return "edit"
+	}
+	return "view"
+}
@@ -0,0 +1,134 @@
+package list_handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Akhanrok/go_labs/config"
+	"github.com/Akhanrok/go_labs/repositories/list_member_repository"
+	"github.com/Akhanrok/go_labs/repositories/list_repository"
+	"github.com/Akhanrok/go_labs/repositories/share_link_repository"
+	"github.com/Akhanrok/go_labs/services"
+	"github.com/Akhanrok/go_labs/services/token_service"
+	"github.com/gorilla/sessions"
+)
+
+// Share links can be valid for up to a year, or until they are revoked
+const maxShareLinkDays = 365
+
+func CreateShareLinkHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, cfg *config.Config) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, ok := accessibleList(w, r, db, list_member_repository.RoleOwner)
+	if !ok {
+		return
+	}
+
+	// An empty value or 0 days creates a link without expiry
+	var expiresAt time.Time
+	if value := r.PostForm.Get("expiresIn"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 || days > maxShareLinkDays {
+			renderEditList(w, r, db, list, fmt.Sprintf("A link can be valid for at most %d days", maxShareLinkDays))
+			return
+		}
+		if days > 0 {
+			expiresAt = time.Now().AddDate(0, 0, days)
+		}
+	}
+
+	token, err := token_service.GenerateToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Only the hash of the token is stored, so the link is shown this one time
+	err = share_link_repository.NewShareLinkRepository(db).CreateLink(list.ID, token_service.HashToken(token), token[:6], expiresAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The link is rendered in this response instead of a flash, which the session store would persist
+	data, err := loadEditListPage(db, list, "", nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.NewLink = fmt.Sprintf("%s/shared-list?token=%s", cfg.BaseURL, url.QueryEscape(token))
+
+	w.Header().Set("Cache-Control", "no-store")
+	services.RenderTemplate(w, r, "edit-list.html", data)
+}
+
+func RevokeShareLinkHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, ok := accessibleList(w, r, db, list_member_repository.RoleOwner)
+	if !ok {
+		return
+	}
+
+	linkID, _ := strconv.Atoi(r.PostForm.Get("linkId"))
+
+	err := share_link_repository.NewShareLinkRepository(db).RevokeLink(list.ID, linkID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	redirectToList(w, r, store, list.ID, "The link has been revoked")
+}
+
+// Show a list read-only to anyone with a valid share link, no login needed
+func SharedListHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Keep the token out of Referer headers and search engines
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Robots-Tag", "noindex")
+
+	var list *list_repository.ListData
+
+	token := r.URL.Query().Get("token")
+	if token != "" {
+		listID, err := share_link_repository.NewShareLinkRepository(db).GetListIDByToken(token_service.HashToken(token))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if listID != 0 {
+			list, err = list_repository.NewListRepository(db).GetPublicList(listID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	data := struct {
+		List *list_repository.ListData
+	}{
+		List: list,
+	}
+
+	if list == nil {
+		w.WriteHeader(http.StatusNotFound)
+	}
+	services.RenderTemplate(w, r, "shared-list.html", data)
+}
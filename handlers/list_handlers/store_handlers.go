@@ -0,0 +1,115 @@
+package list_handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Akhanrok/go_labs/repositories/list_member_repository"
+	"github.com/Akhanrok/go_labs/repositories/list_repository"
+	"github.com/Akhanrok/go_labs/services"
+	"github.com/Akhanrok/go_labs/services/event_service"
+	"github.com/Akhanrok/go_labs/services/session_service"
+	"github.com/Akhanrok/go_labs/services/shopping_service"
+	"github.com/gorilla/sessions"
+)
+
+// Show what is left to buy in all lists of the user, grouped by store
+func ShopByStoreHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, _ := session_service.UserFromContext(r.Context())
+
+	lists, err := list_repository.NewListRepository(db).GetListsData(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Stores []shopping_service.Store
+	}{
+		Stores: shopping_service.ByStore(lists),
+	}
+	services.RenderTemplate(w, r, "shop-by-store.html", data)
+}
+
+// Check off an item of the store view. Every product it was added up from is
+// checked off in the list it came from, which may archive that list.
+func PurchaseStoreItemHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store, broker event_service.Broker) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, _ := session_service.UserFromContext(r.Context())
+	listRepo := list_repository.NewListRepository(db)
+
+	// The products are sent as "listID:productID", each list is loaded once
+	lists := map[int]*list_repository.ListData{}
+	checked := 0
+
+	for _, value := range r.PostForm["item"] {
+		listValue, productValue, _ := strings.Cut(value, ":")
+		listID, err := strconv.Atoi(listValue)
+		if err != nil {
+			http.Error(w, "Invalid item", http.StatusBadRequest)
+			return
+		}
+		productID, err := strconv.Atoi(productValue)
+		if err != nil {
+			http.Error(w, "Invalid item", http.StatusBadRequest)
+			return
+		}
+
+		list, ok := lists[listID]
+		if !ok {
+			list, err = listRepo.GetList(user.ID, listID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			lists[listID] = list
+		}
+		// Lists that were deleted or unshared meanwhile are skipped
+		if list == nil || !list.HasRole(list_member_repository.RoleEditor) {
+			continue
+		}
+
+		product, ok := findProduct(list, productID)
+		if !ok || product.Purchased {
+			continue
+		}
+
+		err = markPurchased(db, broker, list, product, true)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		checked++
+	}
+
+	message := "The item was already checked off"
+	if checked > 0 {
+		message = fmt.Sprintf("%s has been checked off", r.PostForm.Get("product"))
+	}
+
+	err = session_service.AddFlash(w, r, store, session_service.FlashInfo, message)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/shop-by-store", http.StatusFound)
+}
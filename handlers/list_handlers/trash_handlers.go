@@ -0,0 +1,186 @@
+package list_handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Akhanrok/go_labs/repositories/list_member_repository"
+	"github.com/Akhanrok/go_labs/repositories/list_repository"
+	"github.com/Akhanrok/go_labs/services"
+	"github.com/Akhanrok/go_labs/services/event_service"
+	"github.com/Akhanrok/go_labs/services/session_service"
+	"github.com/Akhanrok/go_labs/services/trash_service"
+	"github.com/gorilla/sessions"
+)
+
+// A list in the trash with the time it will be purged
+type trashedList struct {
+	list_repository.ListData
+	PurgeAt time.Time
+}
+
+func DeleteListHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store, broker event_service.Broker) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, ok := accessibleList(w, r, db, list_member_repository.RoleOwner)
+	if !ok {
+		return
+	}
+	user, _ := session_service.UserFromContext(r.Context())
+
+	err := list_repository.NewListRepository(db).DeleteList(user.ID, list.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	publish(broker, list.ID, event_service.ListDeleted, listEventData{ListID: list.ID, Archived: list.Archived})
+
+	err = session_service.AddFlash(w, r, store, session_service.FlashInfo, fmt.Sprintf("%s has been moved to the trash", list.ListName))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/view-lists", http.StatusFound)
+}
+
+func TrashHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, retentionDays int) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := session_service.UserFromContext(r.Context())
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	lists, err := list_repository.NewListRepository(db).GetDeletedLists(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Lists         []trashedList
+		RetentionDays int
+	}{
+		RetentionDays: retentionDays,
+	}
+	for _, list := range lists {
+		data.Lists = append(data.Lists, trashedList{ListData: list, PurgeAt: list.DeletedAt.Add(trash_service.Retention(retentionDays))})
+	}
+
+	services.RenderTemplate(w, r, "trash.html", data)
+}
+
+func RestoreListHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, ok := deletedList(w, r, db)
+	if !ok {
+		return
+	}
+	user, _ := session_service.UserFromContext(r.Context())
+
+	listRepo := list_repository.NewListRepository(db)
+
+	// A new list may have taken the name while this one was in the trash
+	listExists, err := listRepo.IsListExists(user.ID, list.ListName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if listExists {
+		redirectToTrash(w, r, store, session_service.FlashError, fmt.Sprintf("You already have a list named %s, rename it before restoring this one", list.ListName))
+		return
+	}
+
+	err = listRepo.RestoreList(user.ID, list.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	redirectToTrash(w, r, store, session_service.FlashInfo, fmt.Sprintf("%s has been restored", list.ListName))
+}
+
+func PurgeListHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, ok := deletedList(w, r, db)
+	if !ok {
+		return
+	}
+	user, _ := session_service.UserFromContext(r.Context())
+
+	err := list_repository.NewListRepository(db).PurgeList(user.ID, list.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	redirectToTrash(w, r, store, session_service.FlashInfo, fmt.Sprintf("%s has been deleted permanently", list.ListName))
+}
+
+// Find the list named by the "id" parameter in the trash of the current user,
+// otherwise write the error response and return false
+func deletedList(w http.ResponseWriter, r *http.Request, db *sql.DB) (*list_repository.ListData, bool) {
+	user, ok := session_service.UserFromContext(r.Context())
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return nil, false
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	listID, err := strconv.Atoi(r.Form.Get("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+
+	lists, err := list_repository.NewListRepository(db).GetDeletedLists(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	for i := range lists {
+		if lists[i].ID == listID {
+			return &lists[i], true
+		}
+	}
+
+	http.NotFound(w, r)
+	return nil, false
+}
+
+func redirectToTrash(w http.ResponseWriter, r *http.Request, store sessions.Store, kind, message string) {
+	err := session_service.AddFlash(w, r, store, kind, message)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/trash", http.StatusFound)
+}
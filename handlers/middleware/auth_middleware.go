@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/Akhanrok/go_labs/services/session_service"
+	"github.com/gorilla/sessions"
+)
+
+// Let only authenticated users through and put the current user in the request context
+func RequireAuth(store sessions.Store, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := session_service.GetUser(r, store)
+		if err != nil || user == nil {
+			// A session that cannot be decoded is treated like a missing one
+			http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+			return
+		}
+
+		next(w, r.WithContext(session_service.WithUser(r.Context(), user)))
+	}
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/Akhanrok/go_labs/services"
+	"github.com/Akhanrok/go_labs/services/csrf_service"
+	"github.com/Akhanrok/go_labs/services/session_service"
+	"github.com/gorilla/sessions"
+)
+
+// Reject state-changing requests that come from another site or lack the session's token.
+// The token is issued when a page first renders it, so visitors who never get a form,
+// like crawlers, do not create sessions.
+func CSRF(store sessions.Store, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		safe := r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions
+
+		token, err := session_service.CSRFToken(w, r, store, false)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if !safe {
+			submitted := r.Header.Get(csrf_service.HeaderName)
+			if submitted == "" {
+				submitted = r.PostFormValue(csrf_service.FieldName)
+			}
+
+			if !sameOrigin(r) || !csrf_service.ValidToken(token, submitted) {
+				w.WriteHeader(http.StatusForbidden)
+				services.RenderTemplate(w, r, "csrf-error.html", nil)
+				return
+			}
+		}
+
+		ctx := csrf_service.WithTokenSource(r.Context(), func() (string, error) {
+			if token != "" {
+				return token, nil
+			}
+			return session_service.CSRFToken(w, r, store, true)
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Check that the Origin header, or the Referer when there is no Origin, points to this host
+func sameOrigin(r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		// Neither header is sent by some clients, the token check still applies
+		return true
+	}
+
+	u, err := url.Parse(source)
+	if err != nil {
+		return false
+	}
+	return u.Host == r.Host
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Akhanrok/go_labs/services/session_service"
+	"github.com/gorilla/sessions"
+)
+
+// Put the current user, if any, in the request context so every page knows who is logged in
+func LoadUser(store sessions.Store, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := session_service.GetUser(r, store)
+		if err == nil && user != nil {
+			r = r.WithContext(session_service.WithUser(r.Context(), user))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Move queued flash messages from the session to the request context of the next page
+func Flashes(store sessions.Store, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Event streams are opened next to a page and must not take its messages
+		if r.Method == http.MethodGet && !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			flashes, err := session_service.PopFlashes(w, r, store)
+			if err == nil && len(flashes) > 0 {
+				r = r.WithContext(session_service.WithFlashes(r.Context(), flashes))
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Akhanrok/go_labs/repositories/user_repository"
+	"github.com/Akhanrok/go_labs/services"
+	"github.com/Akhanrok/go_labs/services/session_service"
+)
+
+// Block requests that change data from users whose email is still unverified once the grace
+// period after registration is over. Such users can still read their lists, but not change them.
+// It has to be wrapped by RequireAuth, which puts the current user in the request context.
+func RequireVerified(users user_repository.UserRepository, gracePeriod time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next(w, r)
+			return
+		}
+
+		sessionUser, ok := session_service.UserFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		user, err := users.GetUserByID(sessionUser.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		if !user.EmailVerified && time.Since(user.CreatedAt) > gracePeriod {
+			data := struct {
+				Email string
+			}{
+				Email: user.Email,
+			}
+			w.WriteHeader(http.StatusForbidden)
+			services.RenderTemplate(w, r, "verify-email-required.html", data)
+			return
+		}
+
+		next(w, r)
+	}
+}
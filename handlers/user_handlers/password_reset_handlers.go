@@ -0,0 +1,174 @@
+package user_handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Akhanrok/go_labs/config"
+	"github.com/Akhanrok/go_labs/repositories/password_reset_repository"
+	"github.com/Akhanrok/go_labs/repositories/user_repository"
+	"github.com/Akhanrok/go_labs/services"
+	"github.com/Akhanrok/go_labs/services/mail_service"
+	"github.com/Akhanrok/go_labs/services/session_service"
+	"github.com/Akhanrok/go_labs/services/token_service"
+)
+
+// The same message is shown whether the email is registered or not
+const resetRequestedMessage = "If an account exists for this email, we have sent a link to reset the password"
+
+// Store a reset token for the account of the email, if there is one, and mail the link.
+// It runs in the background, so failures are only logged.
+func sendPasswordReset(db *sql.DB, mailer mail_service.Mailer, cfg *config.Config, email string) {
+	user, err := user_repository.NewUserRepository(db).GetUserByEmail(email)
+	if err != nil {
+		log.Printf("failed to look up the account for a password reset: %v", err)
+		return
+	}
+	if user == nil {
+		return
+	}
+
+	token, err := token_service.GenerateToken()
+	if err != nil {
+		log.Printf("failed to generate a password reset token: %v", err)
+		return
+	}
+
+	// Only the hash of the token is stored, the token itself is sent to the user
+	err = password_reset_repository.NewPasswordResetRepository(db).CreateReset(user.ID, token_service.HashToken(token), time.Now().Add(cfg.PasswordResetTTL))
+	if err != nil {
+		log.Printf("failed to store a password reset token: %v", err)
+		return
+	}
+
+	msg := mail_service.Message{
+		To:      email,
+		Subject: "Reset your ShoppingList password",
+		Body: fmt.Sprintf("Hello, %s!\n\nFollow this link to choose a new password:\n%s/reset-password?token=%s\n\nThe link expires in %s. If you did not ask to reset your password, ignore this email.\n",
+			user.Name, cfg.BaseURL, url.QueryEscape(token), cfg.PasswordResetTTL),
+	}
+
+	if err := mailer.Send(msg); err != nil {
+		log.Printf("failed to send password reset email: %v", err)
+	}
+}
+
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, mailer mail_service.Mailer, cfg *config.Config) {
+	if r.Method == http.MethodPost {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		email := r.PostForm.Get("email")
+
+		// Everything that depends on whether the account exists happens after the response,
+		// so both cases answer at once and take the same time
+		go sendPasswordReset(db, mailer, cfg, email)
+
+		data := struct {
+			Message string
+		}{
+			Message: resetRequestedMessage,
+		}
+		services.RenderTemplate(w, r, "forgot-password.html", data)
+		return
+	}
+
+	services.RenderTemplate(w, r, "forgot-password.html", nil)
+}
+
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store *session_service.DBStore) {
+	resetRepo := password_reset_repository.NewPasswordResetRepository(db)
+
+	if r.Method == http.MethodPost {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		token := r.PostForm.Get("token")
+		password := r.PostForm.Get("password")
+		confirmPassword := r.PostForm.Get("confirmPassword")
+
+		data := struct {
+			Token        string
+			ErrorMessage string
+		}{
+			Token: token,
+		}
+
+		if len(password) < 8 {
+			data.ErrorMessage = "Password should be at least 8 characters long"
+			services.RenderTemplate(w, r, "reset-password.html", data)
+			return
+		}
+
+		if password != confirmPassword {
+			data.ErrorMessage = "Passwords do not match"
+			services.RenderTemplate(w, r, "reset-password.html", data)
+			return
+		}
+
+		userID, err := resetRepo.ConsumeReset(token_service.HashToken(token))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if userID == 0 {
+			data.ErrorMessage = "This link is invalid or has expired"
+			services.RenderTemplate(w, r, "reset-password.html", data)
+			return
+		}
+
+		userRepo := user_repository.NewUserRepository(db)
+		err = userRepo.UpdatePassword(userID, password)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Whoever knew the old password is signed out on every device
+		err = store.RevokeOtherSessions(userID, "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = session_service.AddFlash(w, r, store, session_service.FlashInfo, "Your password has been changed, you can log in now")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+
+	valid, err := resetRepo.IsResetValid(token_service.HashToken(token))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Token        string
+		ErrorMessage string
+	}{
+		Token: token,
+	}
+	if !valid {
+		data.ErrorMessage = "This link is invalid or has expired"
+	}
+
+	services.RenderTemplate(w, r, "reset-password.html", data)
+}
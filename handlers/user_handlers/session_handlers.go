@@ -0,0 +1,143 @@
+package user_handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Akhanrok/go_labs/services"
+	"github.com/Akhanrok/go_labs/services/request_service"
+	"github.com/Akhanrok/go_labs/services/session_service"
+	"github.com/gorilla/sessions"
+)
+
+type activeSession struct {
+	ID         string
+	Device     string
+	IP         string
+	LastSeenAt time.Time
+	Current    bool
+}
+
+func LogoutHandler(w http.ResponseWriter, r *http.Request, store sessions.Store) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := session_service.Destroy(w, r, store)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func SessionsHandler(w http.ResponseWriter, r *http.Request, store *session_service.DBStore) {
+	if r.Method == http.MethodGet {
+		user, ok := session_service.UserFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		currentID, err := session_service.CurrentSessionID(r, store)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Retrieve the active sessions of the user from the database
+		rows, err := store.UserSessions(user.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var activeSessions []activeSession
+		for _, row := range rows {
+			activeSessions = append(activeSessions, activeSession{
+				ID:         row.ID,
+				Device:     request_service.DescribeUserAgent(row.UserAgent),
+				IP:         row.IP,
+				LastSeenAt: row.LastSeenAt,
+				Current:    row.ID == currentID,
+			})
+		}
+
+		data := struct {
+			Sessions []activeSession
+		}{
+			Sessions: activeSessions,
+		}
+
+		services.RenderTemplate(w, r, "sessions.html", data)
+	}
+}
+
+func RevokeSessionHandler(w http.ResponseWriter, r *http.Request, store *session_service.DBStore) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := session_service.UserFromContext(r.Context())
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The query is scoped to the user, so other users' sessions cannot be revoked
+	err = store.RevokeSession(user.ID, r.PostForm.Get("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = session_service.AddFlash(w, r, store, session_service.FlashInfo, "The session has been signed out")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/sessions", http.StatusFound)
+}
+
+func RevokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request, store *session_service.DBStore) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := session_service.UserFromContext(r.Context())
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	currentID, err := session_service.CurrentSessionID(r, store)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = store.RevokeOtherSessions(user.ID, currentID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = session_service.AddFlash(w, r, store, session_service.FlashInfo, "All other sessions have been signed out")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/sessions", http.StatusFound)
+}
@@ -0,0 +1,338 @@
+package user_handlers
+
+import (
+	"database/sql"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Akhanrok/go_labs/repositories/totp_repository"
+	"github.com/Akhanrok/go_labs/repositories/user_repository"
+	"github.com/Akhanrok/go_labs/services"
+	"github.com/Akhanrok/go_labs/services/qr_service"
+	"github.com/Akhanrok/go_labs/services/request_service"
+	"github.com/Akhanrok/go_labs/services/session_service"
+	"github.com/Akhanrok/go_labs/services/throttle_service"
+	"github.com/Akhanrok/go_labs/services/token_service"
+	"github.com/Akhanrok/go_labs/services/totp_service"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	totpIssuer        = "ShoppingList"
+	recoveryCodeCount = 10
+)
+
+// Second login step for users with two-factor authentication enabled
+func TwoFactorLoginHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store, throttler *throttle_service.Throttler) {
+	pending, err := session_service.GetPendingTwoFactor(r, store)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if pending == nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		ip := request_service.ClientIP(r)
+
+		decision := throttler.Check(pending.Email, ip)
+		if !decision.Allowed {
+			data := struct {
+				ErrorMessage string
+			}{
+				ErrorMessage: throttledMessage(decision),
+			}
+			w.WriteHeader(http.StatusTooManyRequests)
+			services.RenderTemplate(w, r, "login-2fa.html", data)
+			return
+		}
+
+		totpRepo := totp_repository.NewTOTPRepository(db)
+		ok, err := verifySecondFactor(totpRepo, pending.UserID, r.PostForm.Get("code"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if !ok {
+			data := struct {
+				ErrorMessage string
+			}{
+				ErrorMessage: "Wrong code",
+			}
+			services.RenderTemplate(w, r, "login-2fa.html", data)
+			return
+		}
+
+		throttler.RecordSuccess(pending.Email, ip)
+
+		err = session_service.SetUser(w, r, store, session_service.SessionUser{ID: pending.UserID, Name: pending.Name})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, safeRedirectTarget(pending.Next), http.StatusFound)
+		return
+	}
+
+	services.RenderTemplate(w, r, "login-2fa.html", nil)
+}
+
+func TwoFactorSettingsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method == http.MethodGet {
+		sessionUser, ok := session_service.UserFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		userRepo := user_repository.NewUserRepository(db)
+		user, err := userRepo.GetUserByID(sessionUser.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		totpRepo := totp_repository.NewTOTPRepository(db)
+		totp, err := totpRepo.GetTOTP(user.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := struct {
+			Enabled      bool
+			Secret       string
+			URI          template.URL
+			QRCode       template.HTML
+			ErrorMessage string
+		}{}
+
+		if totp != nil && totp.Enabled {
+			data.Enabled = true
+			services.RenderTemplate(w, r, "two-factor.html", data)
+			return
+		}
+
+		// Start enrollment with a new secret, it is kept until a code confirms it
+		if totp == nil {
+			secret, err := totp_service.GenerateSecret()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			err = totpRepo.SavePendingSecret(user.ID, secret)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			totp = &totp_repository.TOTP{UserID: user.ID, Secret: secret}
+		}
+
+		uri := totp_service.URI(totpIssuer, user.Email, totp.Secret)
+
+		// The QR code is drawn here, so the secret never reaches a third-party script
+		qrCode, err := qr_service.Encode(uri)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data.Secret = totp.Secret
+		data.URI = template.URL(uri)
+		data.QRCode = template.HTML(qrCode.SVG())
+		if r.URL.Query().Get("error") == "code" {
+			data.ErrorMessage = "Wrong code, try again"
+		}
+		services.RenderTemplate(w, r, "two-factor.html", data)
+	}
+}
+
+func EnableTwoFactorHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/2fa", http.StatusFound)
+		return
+	}
+
+	user, ok := session_service.UserFromContext(r.Context())
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	totpRepo := totp_repository.NewTOTPRepository(db)
+	totp, err := totpRepo.GetTOTP(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if totp == nil || totp.Enabled {
+		http.Redirect(w, r, "/2fa", http.StatusFound)
+		return
+	}
+
+	// The code proves the authenticator app holds the secret
+	step, valid := totp_service.Validate(totp.Secret, r.PostForm.Get("code"), time.Now())
+	if !valid {
+		http.Redirect(w, r, "/2fa?error=code", http.StatusFound)
+		return
+	}
+
+	codes, err := totp_service.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = token_service.HashToken(code)
+	}
+
+	err = totpRepo.Enable(user.ID, hashes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = totpRepo.UseStep(user.ID, step)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Recovery codes are only stored hashed, so this is the only time they are shown
+	data := struct {
+		RecoveryCodes []string
+	}{
+		RecoveryCodes: codes,
+	}
+	services.RenderTemplate(w, r, "two-factor-recovery-codes.html", data)
+}
+
+func DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, throttler *throttle_service.Throttler) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/2fa", http.StatusFound)
+		return
+	}
+
+	sessionUser, ok := session_service.UserFromContext(r.Context())
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	userRepo := user_repository.NewUserRepository(db)
+	user, err := userRepo.GetUserByID(sessionUser.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	data := struct {
+		Enabled      bool
+		Secret       string
+		URI          template.URL
+		QRCode       template.HTML
+		ErrorMessage string
+	}{
+		Enabled: true,
+	}
+
+	ip := request_service.ClientIP(r)
+	decision := throttler.Check(user.Email, ip)
+	if !decision.Allowed {
+		data.ErrorMessage = throttledMessage(decision)
+		w.WriteHeader(http.StatusTooManyRequests)
+		services.RenderTemplate(w, r, "two-factor.html", data)
+		return
+	}
+
+	// Turning two-factor authentication off requires the password and a current code
+	validUser, err := userRepo.ValidateCredentials(user.Email, r.PostForm.Get("password"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	totpRepo := totp_repository.NewTOTPRepository(db)
+	validCode := false
+	if validUser != nil {
+		validCode, err = verifySecondFactor(totpRepo, user.ID, r.PostForm.Get("code"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if !validCode {
+		data.ErrorMessage = "Wrong password or code"
+		services.RenderTemplate(w, r, "two-factor.html", data)
+		return
+	}
+	throttler.RecordSuccess(user.Email, ip)
+
+	err = totpRepo.Disable(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/2fa", http.StatusFound)
+}
+
+// Accept either a current authenticator code or an unused recovery code
+func verifySecondFactor(totpRepo totp_repository.TOTPRepository, userID int, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+
+	if len(code) > totp_service.Digits {
+		hash := token_service.HashToken(totp_service.NormalizeRecoveryCode(code))
+		return totpRepo.UseRecoveryCode(userID, hash)
+	}
+
+	totp, err := totpRepo.GetTOTP(userID)
+	if err != nil || totp == nil || !totp.Enabled {
+		return false, err
+	}
+
+	step, ok := totp_service.Validate(totp.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	// A code cannot be used twice, even within its time window
+	return totpRepo.UseStep(userID, step)
+}
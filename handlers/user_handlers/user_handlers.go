@@ -1,155 +1,258 @@
-package user_handlers
-
-import (
-	"database/sql"
-	"net/http"
-
-	"github.com/Akhanrok/go_labs/repositories/user_repository"
-	"github.com/Akhanrok/go_labs/services"
-	"github.com/gorilla/sessions"
-)
-
-func IndexHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		services.RenderTemplate(w, "index.html", nil)
-	}
-}
-
-func LoginHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store) {
-	if r.Method == http.MethodPost {
-		err := r.ParseForm()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		email := r.PostForm.Get("email")
-		password := r.PostForm.Get("password")
-
-		// Create instances of the repositories
-		userRepo := user_repository.NewUserRepository(db)
-
-		// Check the credentials in the database
-		username, err := userRepo.ValidateCredentials(email, password)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		if username == "" {
-			data := struct {
-				ErrorMessage string
-			}{
-				ErrorMessage: "Wrong credentials",
-			}
-			services.RenderTemplate(w, "login.html", data)
-			return
-		}
-
-		// Create a session for the authenticated user
-		session, err := store.Get(r, "session-name")
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		// Set the username in the session
-		session.Values["username"] = username
-		err = session.Save(r, w)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		data := struct {
-			Username string
-		}{
-			Username: username,
-		}
-
-		services.RenderTemplate(w, "login-success.html", data)
-		return
-	}
-
-	services.RenderTemplate(w, "login.html", nil)
-}
-
-func RegisterHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
-	if r.Method == http.MethodPost {
-		err := r.ParseForm()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		name := r.PostForm.Get("name")
-		email := r.PostForm.Get("email")
-		password := r.PostForm.Get("password")
-
-		if name == "" || email == "" || password == "" {
-			http.Error(w, "All fields are required", http.StatusBadRequest)
-			return
-		}
-
-		if !services.IsValidEmail(email) {
-			http.Error(w, "Invalid email", http.StatusBadRequest)
-			return
-		}
-
-		if len(password) < 8 {
-			data := struct {
-				ErrorMessage string
-			}{
-				ErrorMessage: "Password should be at least 8 characters long",
-			}
-			services.RenderTemplate(w, "register.html", data)
-			return
-		}
-
-		// Create instances of the repositories
-		userRepo := user_repository.NewUserRepository(db)
-
-		// Check if the email already exists in the database
-		emailExists, err := userRepo.IsEmailExists(email)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		if emailExists {
-			data := struct {
-				ErrorMessage string
-			}{
-				ErrorMessage: "Email already exists",
-			}
-			services.RenderTemplate(w, "register.html", data)
-			return
-		}
-
-		// Insert the new user into the database
-		insertQuery := "INSERT INTO users (name, email, password) VALUES (?, ?, ?)"
-		_, err = db.Exec(insertQuery, name, email, password)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		// Redirect to the register success page
-		http.Redirect(w, r, "/register-success", http.StatusFound)
-		return
-	}
-
-	services.RenderTemplate(w, "register.html", nil)
-}
-
-func LoginSuccessHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
-	if r.Method == http.MethodGet {
-		services.RenderTemplate(w, "login-success.html", nil)
-	}
-}
-
-func RegisterSuccessHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		services.RenderTemplate(w, "register-success.html", nil)
-	}
-}
+package user_handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Akhanrok/go_labs/config"
+	"github.com/Akhanrok/go_labs/repositories/totp_repository"
+	"github.com/Akhanrok/go_labs/repositories/user_repository"
+	"github.com/Akhanrok/go_labs/services"
+	"github.com/Akhanrok/go_labs/services/mail_service"
+	"github.com/Akhanrok/go_labs/services/request_service"
+	"github.com/Akhanrok/go_labs/services/session_service"
+	"github.com/Akhanrok/go_labs/services/throttle_service"
+	"github.com/gorilla/sessions"
+)
+
+func IndexHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		services.RenderTemplate(w, r, "index.html", nil)
+	}
+}
+
+func LoginHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store sessions.Store, throttler *throttle_service.Throttler) {
+	if r.Method == http.MethodPost {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		email := r.PostForm.Get("email")
+		password := r.PostForm.Get("password")
+		next := r.PostForm.Get("next")
+
+		ip := request_service.ClientIP(r)
+
+		// Refuse the attempt without checking the password while the account or address is throttled
+		decision := throttler.Check(email, ip)
+		if !decision.Allowed {
+			data := struct {
+				ErrorMessage string
+				Next         string
+			}{
+				ErrorMessage: throttledMessage(decision),
+				Next:         next,
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(decision.RetryAfter.Seconds()))))
+			w.WriteHeader(http.StatusTooManyRequests)
+			services.RenderTemplate(w, r, "login.html", data)
+			return
+		}
+
+		// Create instances of the repositories
+		userRepo := user_repository.NewUserRepository(db)
+
+		// Check the credentials in the database
+		user, err := userRepo.ValidateCredentials(email, password)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if user == nil {
+			data := struct {
+				ErrorMessage string
+				Next         string
+			}{
+				ErrorMessage: "Wrong credentials",
+				Next:         next,
+			}
+			services.RenderTemplate(w, r, "login.html", data)
+			return
+		}
+
+		// Ask for the second factor before logging in users who enabled it
+		totpRepo := totp_repository.NewTOTPRepository(db)
+		twoFactorEnabled, err := totpRepo.IsEnabled(user.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if twoFactorEnabled {
+			// The password was right, only the second factor still counts against the account
+			throttler.Refund(email, ip)
+
+			pending := session_service.PendingTwoFactor{UserID: user.ID, Name: user.Name, Email: user.Email, Next: next}
+			err = session_service.SetPendingTwoFactor(w, r, store, pending)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			http.Redirect(w, r, "/login/2fa", http.StatusFound)
+			return
+		}
+
+		throttler.RecordSuccess(email, ip)
+
+		// Store the identity of the authenticated user in the session
+		err = session_service.SetUser(w, r, store, session_service.SessionUser{ID: user.ID, Name: user.Name})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Redirect to the page the user was trying to open or to the main page
+		http.Redirect(w, r, safeRedirectTarget(next), http.StatusFound)
+		return
+	}
+
+	data := struct {
+		ErrorMessage string
+		Next         string
+	}{
+		Next: r.URL.Query().Get("next"),
+	}
+	services.RenderTemplate(w, r, "login.html", data)
+}
+
+func RegisterHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, mailer mail_service.Mailer, cfg *config.Config) {
+	if r.Method == http.MethodPost {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		name := r.PostForm.Get("name")
+		email := r.PostForm.Get("email")
+		password := r.PostForm.Get("password")
+
+		if name == "" || email == "" || password == "" {
+			http.Error(w, "All fields are required", http.StatusBadRequest)
+			return
+		}
+
+		if !services.IsValidEmail(email) {
+			http.Error(w, "Invalid email", http.StatusBadRequest)
+			return
+		}
+
+		if len(password) < 8 {
+			data := struct {
+				ErrorMessage string
+			}{
+				ErrorMessage: "Password should be at least 8 characters long",
+			}
+			services.RenderTemplate(w, r, "register.html", data)
+			return
+		}
+
+		// Create instances of the repositories
+		userRepo := user_repository.NewUserRepository(db)
+
+		// Check if the email already exists in the database
+		emailExists, err := userRepo.IsEmailExists(email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if emailExists {
+			data := struct {
+				ErrorMessage string
+			}{
+				ErrorMessage: "Email already exists",
+			}
+			services.RenderTemplate(w, r, "register.html", data)
+			return
+		}
+
+		// Insert the new user into the database
+		userID, err := userRepo.CreateUser(name, email, password)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// The account stays unverified until the link in this email is followed
+		sendVerificationEmail(mailer, cfg, &user_repository.User{ID: userID, Name: name, Email: email})
+
+		// Redirect to the register success page
+		http.Redirect(w, r, "/register-success", http.StatusFound)
+		return
+	}
+
+	services.RenderTemplate(w, r, "register.html", nil)
+}
+
+func LoginSuccessHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, cfg *config.Config) {
+	if r.Method == http.MethodGet {
+		sessionUser, ok := session_service.UserFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		userRepo := user_repository.NewUserRepository(db)
+		user, err := userRepo.GetUserByID(sessionUser.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		data := struct {
+			Username           string
+			Email              string
+			Unverified         bool
+			VerificationDueAt  time.Time
+			VerificationMissed bool
+		}{
+			Username:           user.Name,
+			Email:              user.Email,
+			Unverified:         !user.EmailVerified,
+			VerificationDueAt:  user.CreatedAt.Add(cfg.Verification.GracePeriod),
+			VerificationMissed: time.Since(user.CreatedAt) > cfg.Verification.GracePeriod,
+		}
+		services.RenderTemplate(w, r, "login-success.html", data)
+	}
+}
+
+func RegisterSuccessHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		data := struct {
+			Message string
+		}{
+			Message: "We have sent a verification link to your email",
+		}
+		services.RenderTemplate(w, r, "register-success.html", data)
+	}
+}
+
+// Explain why a login attempt was refused
+func throttledMessage(decision throttle_service.Decision) string {
+	if decision.Locked {
+		return fmt.Sprintf("This account is temporarily locked after too many failed attempts. Try again after %s", decision.LockedUntil.Format("15:04"))
+	}
+	return fmt.Sprintf("Too many failed attempts. Try again in %d seconds", int(math.Ceil(decision.RetryAfter.Seconds())))
+}
+
+// Only allow redirects to local paths so the next parameter cannot send users to another site
+func safeRedirectTarget(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/login-success"
+	}
+	return next
+}
@@ -0,0 +1,144 @@
+package user_handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Akhanrok/go_labs/config"
+	"github.com/Akhanrok/go_labs/repositories/user_repository"
+	"github.com/Akhanrok/go_labs/services"
+	"github.com/Akhanrok/go_labs/services/mail_service"
+	"github.com/Akhanrok/go_labs/services/request_service"
+	"github.com/Akhanrok/go_labs/services/throttle_service"
+	"github.com/Akhanrok/go_labs/services/token_service"
+)
+
+// The same message is shown whether an unverified account exists for the email or not
+const verificationResentMessage = "If an unverified account exists for this email, we have sent a new verification link"
+
+func VerifyEmailHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, cfg *config.Config) {
+	if r.Method == http.MethodGet {
+		data := struct {
+			Message      string
+			ErrorMessage string
+		}{}
+
+		payload, err := token_service.VerifySignedToken(cfg.Verification.Secret, r.URL.Query().Get("token"), time.Now())
+		if err == token_service.ErrExpiredToken {
+			data.ErrorMessage = "This verification link has expired, log in to request a new one"
+			services.RenderTemplate(w, r, "verify-email.html", data)
+			return
+		}
+		if err != nil {
+			data.ErrorMessage = "This verification link is invalid"
+			services.RenderTemplate(w, r, "verify-email.html", data)
+			return
+		}
+
+		userID, email, ok := parseVerificationPayload(payload)
+		if !ok {
+			data.ErrorMessage = "This verification link is invalid"
+			services.RenderTemplate(w, r, "verify-email.html", data)
+			return
+		}
+
+		userRepo := user_repository.NewUserRepository(db)
+		verified, err := userRepo.MarkEmailVerified(userID, email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if !verified {
+			data.ErrorMessage = "This verification link is invalid"
+		} else {
+			data.Message = "Your email has been verified"
+		}
+		services.RenderTemplate(w, r, "verify-email.html", data)
+	}
+}
+
+func ResendVerificationHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, mailer mail_service.Mailer, cfg *config.Config, throttler *throttle_service.Throttler) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	email := r.PostForm.Get("email")
+
+	data := struct {
+		ErrorMessage string
+		Message      string
+		Next         string
+	}{}
+
+	// Every request counts, whether an account exists for the email or not
+	decision := throttler.Check(email, request_service.ClientIP(r))
+	if !decision.Allowed {
+		retryAfter := int(math.Ceil(decision.RetryAfter.Seconds()))
+		data.ErrorMessage = fmt.Sprintf("Too many verification emails were requested. Try again in %d seconds", retryAfter)
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		w.WriteHeader(http.StatusTooManyRequests)
+		services.RenderTemplate(w, r, "login.html", data)
+		return
+	}
+
+	userRepo := user_repository.NewUserRepository(db)
+	user, err := userRepo.GetUserByEmail(email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if user != nil && !user.EmailVerified {
+		sendVerificationEmail(mailer, cfg, user)
+	}
+
+	data.Message = verificationResentMessage
+	services.RenderTemplate(w, r, "login.html", data)
+}
+
+// Send a signed verification link in the background so the response time does not reveal the account
+func sendVerificationEmail(mailer mail_service.Mailer, cfg *config.Config, user *user_repository.User) {
+	payload := strconv.Itoa(user.ID) + ":" + user.Email
+	token := token_service.SignToken(cfg.Verification.Secret, payload, time.Now().Add(cfg.Verification.LinkTTL))
+
+	msg := mail_service.Message{
+		To:      user.Email,
+		Subject: "Verify your ShoppingList email",
+		Body: fmt.Sprintf("Hello, %s!\n\nFollow this link to verify your email:\n%s/verify-email?token=%s\n\nThe link expires in %s.\n",
+			user.Name, cfg.BaseURL, url.QueryEscape(token), cfg.Verification.LinkTTL),
+	}
+
+	go func() {
+		if err := mailer.Send(msg); err != nil {
+			log.Printf("failed to send verification email: %v", err)
+		}
+	}()
+}
+
+func parseVerificationPayload(payload string) (int, string, bool) {
+	parts := strings.SplitN(payload, ":", 2)
+	if len(parts) != 2 {
+		return 0, "", false
+	}
+
+	userID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", false
+	}
+	return userID, parts[1], true
+}
@@ -1,78 +1,206 @@
-package main
-
-import (
-	"log"
-	"net/http"
-
-	"github.com/Akhanrok/go_labs/handlers/list_handlers"
-	"github.com/Akhanrok/go_labs/handlers/user_handlers"
-	"github.com/Akhanrok/go_labs/repositories/database_repository"
-	_ "github.com/go-sql-driver/mysql"
-	"github.com/google/uuid"
-	"github.com/gorilla/sessions"
-)
-
-var store *sessions.CookieStore
-
-// generate a unique secret key for session cookie store
-func generateSecretKey() string {
-	key := uuid.New().String()
-	return key
-}
-
-func main() {
-	// Create a database connection
-	var err error
-	db, err := database_repository.NewDatabase("root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
-
-	// Generate a unique secret key for session cookie store
-	secretKey := generateSecretKey()
-
-	// Configure session store
-	store = sessions.NewCookieStore([]byte(secretKey))
-
-	// Serve static files from the "static" directory
-	fs := http.FileServer(http.Dir("static"))
-	http.Handle("/static/", http.StripPrefix("/static/", fs))
-
-	// Register routes
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		user_handlers.IndexHandler(w, r)
-	})
-
-	http.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
-		user_handlers.LoginHandler(w, r, db, store)
-	})
-
-	http.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
-		user_handlers.RegisterHandler(w, r, db)
-	})
-
-	http.HandleFunc("/login-success", func(w http.ResponseWriter, r *http.Request) {
-		user_handlers.LoginSuccessHandler(w, r, db)
-	})
-
-	http.HandleFunc("/register-success", func(w http.ResponseWriter, r *http.Request) {
-		user_handlers.RegisterSuccessHandler(w, r)
-	})
-
-	http.HandleFunc("/create-list", func(w http.ResponseWriter, r *http.Request) {
-		list_handlers.CreateListHandler(w, r, db, store)
-	})
-
-	http.HandleFunc("/list-success", func(w http.ResponseWriter, r *http.Request) {
-		list_handlers.ListSuccessHandler(w, r)
-	})
-
-	http.HandleFunc("/view-lists", func(w http.ResponseWriter, r *http.Request) {
-		list_handlers.ViewListsHandler(w, r, db, store)
-	})
-
-	// Start the server
-	log.Println("Server is running on http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
-}
+package main
+
+import (
+	"flag"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Akhanrok/go_labs/config"
+	"github.com/Akhanrok/go_labs/handlers/list_handlers"
+	"github.com/Akhanrok/go_labs/handlers/middleware"
+	"github.com/Akhanrok/go_labs/handlers/user_handlers"
+	"github.com/Akhanrok/go_labs/repositories/database_repository"
+	"github.com/Akhanrok/go_labs/repositories/list_repository"
+	"github.com/Akhanrok/go_labs/repositories/list_schedule_repository"
+	"github.com/Akhanrok/go_labs/repositories/user_repository"
+	"github.com/Akhanrok/go_labs/services"
+	"github.com/Akhanrok/go_labs/services/event_service"
+	"github.com/Akhanrok/go_labs/services/mail_service"
+	"github.com/Akhanrok/go_labs/services/password_service"
+	"github.com/Akhanrok/go_labs/services/schedule_service"
+	"github.com/Akhanrok/go_labs/services/session_service"
+	"github.com/Akhanrok/go_labs/services/throttle_service"
+	"github.com/Akhanrok/go_labs/services/token_service"
+	"github.com/Akhanrok/go_labs/services/trash_service"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+var store *session_service.DBStore
+
+func main() {
+	dev := flag.Bool("dev", false, "read templates and static files from disk and reload them on change")
+	flag.Parse()
+
+	// Load the configuration from the environment
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Parse all templates up front so a broken template stops the server from starting
+	var assetsFS fs.FS = assets
+	if *dev {
+		assetsFS = os.DirFS(".")
+	}
+	renderer, err := services.NewRenderer(assetsFS, *dev)
+	if err != nil {
+		log.Fatal(err)
+	}
+	services.SetRenderer(renderer)
+
+	// Create a database connection
+	db, err := database_repository.NewDatabase(cfg.DatabaseDSN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	// Bring the database schema up to date
+	err = database_repository.Migrate(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Choose the password hashing algorithm, bcrypt unless configured otherwise
+	hasher, err := password_service.NewHasher(cfg.PasswordHasher)
+	if err != nil {
+		log.Fatal(err)
+	}
+	password_service.SetDefault(hasher)
+
+	// Use temporary session keys when none are configured
+	if len(cfg.Session.KeyPairs) == 0 {
+		log.Println("SESSION_KEYS is not set, using temporary keys: sessions will not survive a restart")
+		cfg.Session.KeyPairs, err = config.GenerateSessionKeys()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Sign verification links with a key derived from the current session key unless a secret is configured
+	if len(cfg.Verification.Secret) == 0 {
+		cfg.Verification.Secret = token_service.DeriveKey(cfg.Session.KeyPairs[0], "email-verification")
+	}
+
+	// Configure session store and delete expired sessions in the background
+	store = session_service.NewDBStore(db, cfg.Session)
+	go store.CleanupExpired(time.Hour)
+
+	// Remove lists that stayed in the trash longer than the retention period
+	go trash_service.PurgeExpired(list_repository.NewListRepository(db), trash_service.Retention(cfg.TrashRetentionDays), time.Hour)
+
+	// Generate recurring lists when they are due
+	schedule_service.SetLocation(cfg.ScheduleLocation)
+	go schedule_service.Run(list_schedule_repository.NewListScheduleRepository(db), time.Minute)
+
+	// Configure the mailer used for account emails
+	mailer, err := mail_service.NewMailer(cfg.Mail)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Throttle failed logins per account and per client address
+	throttler := throttle_service.NewThrottler(cfg.LoginThrottle, throttle_service.NewMemoryStore(cfg.LoginThrottle.Window, throttle_service.SystemClock), throttle_service.SystemClock)
+
+	// Limit verification emails per email and per client address
+	resendThrottler := throttle_service.NewThrottler(cfg.ResendThrottle, throttle_service.NewMemoryStore(cfg.ResendThrottle.Window, throttle_service.SystemClock), throttle_service.SystemClock)
+
+	// Distribute list changes to the browsers that have the list open
+	hub := event_service.NewHub()
+
+	// Register routes
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		user_handlers.IndexHandler(w, r)
+	})
+
+	http.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		user_handlers.LoginHandler(w, r, db, store, throttler)
+	})
+
+	http.HandleFunc("/login/2fa", func(w http.ResponseWriter, r *http.Request) {
+		user_handlers.TwoFactorLoginHandler(w, r, db, store, throttler)
+	})
+
+	http.HandleFunc("/2fa", middleware.RequireAuth(store, func(w http.ResponseWriter, r *http.Request) {
+		user_handlers.TwoFactorSettingsHandler(w, r, db)
+	}))
+
+	http.HandleFunc("/2fa/enable", middleware.RequireAuth(store, func(w http.ResponseWriter, r *http.Request) {
+		user_handlers.EnableTwoFactorHandler(w, r, db)
+	}))
+
+	http.HandleFunc("/2fa/disable", middleware.RequireAuth(store, func(w http.ResponseWriter, r *http.Request) {
+		user_handlers.DisableTwoFactorHandler(w, r, db, throttler)
+	}))
+
+	http.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		user_handlers.LogoutHandler(w, r, store)
+	})
+
+	http.HandleFunc("/sessions", middleware.RequireAuth(store, func(w http.ResponseWriter, r *http.Request) {
+		user_handlers.SessionsHandler(w, r, store)
+	}))
+
+	http.HandleFunc("/sessions/revoke", middleware.RequireAuth(store, func(w http.ResponseWriter, r *http.Request) {
+		user_handlers.RevokeSessionHandler(w, r, store)
+	}))
+
+	http.HandleFunc("/sessions/revoke-others", middleware.RequireAuth(store, func(w http.ResponseWriter, r *http.Request) {
+		user_handlers.RevokeOtherSessionsHandler(w, r, store)
+	}))
+
+	http.HandleFunc("/forgot-password", func(w http.ResponseWriter, r *http.Request) {
+		user_handlers.ForgotPasswordHandler(w, r, db, mailer, cfg)
+	})
+
+	http.HandleFunc("/reset-password", func(w http.ResponseWriter, r *http.Request) {
+		user_handlers.ResetPasswordHandler(w, r, db, store)
+	})
+
+	http.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
+		user_handlers.RegisterHandler(w, r, db, mailer, cfg)
+	})
+
+	http.HandleFunc("/verify-email", func(w http.ResponseWriter, r *http.Request) {
+		user_handlers.VerifyEmailHandler(w, r, db, cfg)
+	})
+
+	http.HandleFunc("/resend-verification", func(w http.ResponseWriter, r *http.Request) {
+		user_handlers.ResendVerificationHandler(w, r, db, mailer, cfg, resendThrottler)
+	})
+
+	http.HandleFunc("/login-success", middleware.RequireAuth(store, func(w http.ResponseWriter, r *http.Request) {
+		user_handlers.LoginSuccessHandler(w, r, db, cfg)
+	}))
+
+	http.HandleFunc("/register-success", func(w http.ResponseWriter, r *http.Request) {
+		user_handlers.RegisterSuccessHandler(w, r)
+	})
+
+	http.HandleFunc("/list-success", func(w http.ResponseWriter, r *http.Request) {
+		list_handlers.ListSuccessHandler(w, r)
+	})
+
+	// Public read-only page for share links, no login needed
+	http.HandleFunc("/shared-list", func(w http.ResponseWriter, r *http.Request) {
+		list_handlers.SharedListHandler(w, r, db)
+	})
+
+	// Every list route needs a login, and changing lists needs a verified email after the grace period
+	list_handlers.RegisterRoutes(http.DefaultServeMux, list_handlers.Routes(db, store, hub, mailer, cfg), store, user_repository.NewUserRepository(db), cfg.Verification.GracePeriod)
+
+	// Serve static files, outside of the session and CSRF handling
+	handler := http.NewServeMux()
+	handler.Handle("/static/", http.StripPrefix("/static/", renderer.StaticHandler()))
+
+	// Every other route requires a valid CSRF token for state-changing requests and
+	// gets the current user and pending flash messages for the shared layout
+	handler.Handle("/", middleware.CSRF(store, middleware.LoadUser(store, middleware.Flashes(store, http.DefaultServeMux))))
+
+	// Start the server
+	log.Printf("Server is running on %s", cfg.Addr)
+	log.Fatal(http.ListenAndServe(cfg.Addr, handler))
+}
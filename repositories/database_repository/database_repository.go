@@ -1,18 +1,27 @@
-package database_repository
-
-import (
-	"database/sql"
-)
-
-var db *sql.DB
-
-// Create a new database connection
-func NewDatabase(dataSourceName string) (*sql.DB, error) {
-	// Initialize the database connection
-	database, err := sql.Open("mysql", dataSourceName)
-	if err != nil {
-		return nil, err
-	}
-	db = database
-	return db, nil
-}
+package database_repository
+
+import (
+	"database/sql"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+var db *sql.DB
+
+// Create a new database connection
+func NewDatabase(dataSourceName string) (*sql.DB, error) {
+	// Repositories scan DATETIME columns into time.Time, which needs parseTime
+	cfg, err := mysql.ParseDSN(dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ParseTime = true
+
+	// Initialize the database connection
+	database, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+	db = database
+	return db, nil
+}
@@ -0,0 +1,302 @@
+package database_repository
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type migration struct {
+	version    int
+	statements []string
+	// MySQL errors on which a statement is skipped instead of failing the migration,
+	// for features that the application can do without
+	skipErrors []uint16
+}
+
+const (
+	// The storage engine of the table does not support FULLTEXT indexes
+	errFulltextNotSupported = 1214
+	// The columns cannot be in a FULLTEXT index
+	errNoFulltextIndex = 1191
+)
+
+// Schema changes in the order they have to be applied, new entries go at the end
+var migrations = []migration{
+	{
+		version: 1,
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS users (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				name VARCHAR(255) NOT NULL,
+				email VARCHAR(255) NOT NULL UNIQUE,
+				password VARCHAR(255) NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS lists (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				user_id INT NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				FOREIGN KEY (user_id) REFERENCES users(id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS products (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				list_id INT NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				quantity INT NOT NULL,
+				store VARCHAR(255) NOT NULL,
+				FOREIGN KEY (list_id) REFERENCES lists(id)
+			)`,
+		},
+	},
+	{
+		// Password hashes are longer than the plaintext values they replace
+		version: 2,
+		statements: []string{
+			"ALTER TABLE users MODIFY password VARCHAR(255) NOT NULL",
+		},
+	},
+	{
+		version: 3,
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS sessions (
+				id VARCHAR(64) PRIMARY KEY,
+				user_id INT NULL,
+				data BLOB NOT NULL,
+				user_agent VARCHAR(255) NOT NULL DEFAULT '',
+				ip VARCHAR(45) NOT NULL DEFAULT '',
+				created_at DATETIME NOT NULL,
+				last_seen_at DATETIME NOT NULL,
+				expires_at DATETIME NOT NULL,
+				INDEX idx_sessions_user_id (user_id),
+				INDEX idx_sessions_expires_at (expires_at),
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			)`,
+		},
+	},
+	{
+		version: 4,
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS password_resets (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				user_id INT NOT NULL,
+				token_hash CHAR(64) NOT NULL UNIQUE,
+				created_at DATETIME NOT NULL,
+				expires_at DATETIME NOT NULL,
+				used_at DATETIME NULL,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			)`,
+		},
+	},
+	{
+		// Accounts created before email verification existed are treated as verified
+		version: 5,
+		statements: []string{
+			"ALTER TABLE users ADD COLUMN email_verified_at DATETIME NULL, ADD COLUMN created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP",
+			"UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL",
+		},
+	},
+	{
+		version: 6,
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS user_totp (
+				user_id INT PRIMARY KEY,
+				secret VARCHAR(64) NOT NULL,
+				enabled_at DATETIME NULL,
+				last_used_step BIGINT NOT NULL DEFAULT 0,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			)`,
+			`CREATE TABLE IF NOT EXISTS user_recovery_codes (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				user_id INT NOT NULL,
+				code_hash CHAR(64) NOT NULL,
+				used_at DATETIME NULL,
+				INDEX idx_user_recovery_codes_user_id (user_id),
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			)`,
+		},
+	},
+	{
+		// Deleted lists stay in the trash until they are restored or purged
+		version: 7,
+		statements: []string{
+			"ALTER TABLE lists ADD COLUMN deleted_at DATETIME NULL",
+			"CREATE INDEX idx_lists_deleted_at ON lists (deleted_at)",
+		},
+	},
+	{
+		// Products are checked off while shopping, lists may archive themselves once everything is bought
+		version: 8,
+		statements: []string{
+			"ALTER TABLE products ADD COLUMN purchased_at DATETIME NULL",
+			"ALTER TABLE lists ADD COLUMN auto_archive BOOLEAN NOT NULL DEFAULT FALSE",
+			"ALTER TABLE lists ADD COLUMN archived_at DATETIME NULL",
+		},
+	},
+	{
+		// Users a list is shared with, the owner stays in lists.user_id
+		version: 9,
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS list_members (
+				list_id INT NOT NULL,
+				user_id INT NOT NULL,
+				role VARCHAR(16) NOT NULL,
+				created_at DATETIME NOT NULL,
+				PRIMARY KEY (list_id, user_id),
+				INDEX idx_list_members_user_id (user_id),
+				FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE CASCADE,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			)`,
+		},
+	},
+	{
+		// Public read-only links, only the hash of the token is stored
+		version: 10,
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS list_share_links (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				list_id INT NOT NULL,
+				token_hash CHAR(64) NOT NULL UNIQUE,
+				token_hint VARCHAR(8) NOT NULL,
+				created_at DATETIME NOT NULL,
+				expires_at DATETIME NULL,
+				revoked_at DATETIME NULL,
+				INDEX idx_list_share_links_list_id (list_id),
+				FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE CASCADE
+			)`,
+		},
+	},
+	{
+		// Every saved change increases the version, so concurrent edits are detected
+		version: 11,
+		statements: []string{
+			"ALTER TABLE lists ADD COLUMN version INT NOT NULL DEFAULT 1",
+			"ALTER TABLE products ADD COLUMN version INT NOT NULL DEFAULT 1",
+		},
+	},
+	{
+		// Reusable sets of products a list can be created from
+		version: 12,
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS list_templates (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				user_id INT NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				created_at DATETIME NOT NULL,
+				UNIQUE KEY uq_list_templates_user_name (user_id, name),
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			)`,
+			`CREATE TABLE IF NOT EXISTS list_template_items (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				template_id INT NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				quantity INT NOT NULL,
+				store VARCHAR(255) NOT NULL,
+				INDEX idx_list_template_items_template_id (template_id),
+				FOREIGN KEY (template_id) REFERENCES list_templates(id) ON DELETE CASCADE
+			)`,
+		},
+	},
+	{
+		// Lists that recreate themselves, next_run_at is the next occurrence not generated yet
+		version: 13,
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS list_schedules (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				list_id INT NOT NULL UNIQUE,
+				rule VARCHAR(255) NOT NULL,
+				starts_on DATE NOT NULL,
+				carry_over BOOLEAN NOT NULL DEFAULT FALSE,
+				next_run_at DATETIME NOT NULL,
+				last_list_id INT NULL,
+				INDEX idx_list_schedules_next_run_at (next_run_at),
+				FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE CASCADE,
+				FOREIGN KEY (last_list_id) REFERENCES lists(id) ON DELETE SET NULL
+			)`,
+		},
+	},
+	{
+		// Indexes for searching lists and products, search falls back to LIKE on databases without them
+		version: 14,
+		statements: []string{
+			"ALTER TABLE lists ADD FULLTEXT INDEX ft_lists_name (name)",
+			"ALTER TABLE products ADD FULLTEXT INDEX ft_products_name_store (name, store)",
+		},
+		skipErrors: []uint16{errFulltextNotSupported, errNoFulltextIndex},
+	},
+	{
+		// Lists can be sorted by the date they were created, existing lists get the date of the migration
+		version: 15,
+		statements: []string{
+			"ALTER TABLE lists ADD COLUMN created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP",
+			"ALTER TABLE lists ADD INDEX idx_lists_user_created (user_id, created_at)",
+		},
+	},
+	{
+		// Lists are shared by invitation, so sharing does not tell whether an email has an account
+		version: 16,
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS list_invitations (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				list_id INT NOT NULL,
+				email VARCHAR(255) NOT NULL,
+				role VARCHAR(16) NOT NULL,
+				token_hash CHAR(64) NOT NULL UNIQUE,
+				created_at DATETIME NOT NULL,
+				expires_at DATETIME NOT NULL,
+				UNIQUE KEY uq_list_invitations_list_email (list_id, email),
+				FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE CASCADE
+			)`,
+		},
+	},
+}
+
+// Apply the migrations that have not been applied to the database yet
+func Migrate(db *sql.DB) error {
+	_, err := db.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (version INT PRIMARY KEY)")
+	if err != nil {
+		return err
+	}
+
+	var current int
+	err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		for _, statement := range m.statements {
+			if _, err := db.Exec(statement); err != nil {
+				if !m.skips(err) {
+					return err
+				}
+				log.Printf("migration %d: skipped a statement the database does not support: %v", m.version, err)
+			}
+		}
+
+		_, err = db.Exec("INSERT INTO schema_migrations (version) VALUES (?)", m.version)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m migration) skips(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	for _, number := range m.skipErrors {
+		if mysqlErr.Number == number {
+			return true
+		}
+	}
+	return false
+}
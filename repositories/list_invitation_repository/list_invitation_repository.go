@@ -0,0 +1,130 @@
+package list_invitation_repository
+
+import (
+	"database/sql"
+	"time"
+)
+
+// An invitation to a list sent to an email address, whether or not it has an account yet
+type Invitation struct {
+	ID        int
+	ListID    int
+	Email     string
+	Role      string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// The list and its owner, for the page that accepts the invitation
+	ListName  string
+	OwnerName string
+}
+
+type ListInvitationRepository interface {
+	CreateInvitation(listID int, email, role, tokenHash string, expiresAt time.Time) error
+	GetInvitations(listID int) ([]Invitation, error)
+	GetInvitationByToken(tokenHash string) (*Invitation, error)
+	AcceptInvitation(invitation *Invitation, userID int) error
+	RevokeInvitation(listID, invitationID int) error
+}
+
+type listInvitationRepository struct {
+	db *sql.DB
+}
+
+func NewListInvitationRepository(db *sql.DB) ListInvitationRepository {
+	return &listInvitationRepository{db}
+}
+
+// Store the invitation, replacing an earlier one to the same email so only the newest link works
+func (r *listInvitationRepository) CreateInvitation(listID int, email, role, tokenHash string, expiresAt time.Time) error {
+	query := `INSERT INTO list_invitations (list_id, email, role, token_hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE role = VALUES(role), token_hash = VALUES(token_hash),
+			created_at = VALUES(created_at), expires_at = VALUES(expires_at)`
+	_, err := r.db.Exec(query, listID, email, role, tokenHash, time.Now().UTC(), expiresAt.UTC())
+	return err
+}
+
+// Return the invitations of the list that were neither accepted nor expired
+func (r *listInvitationRepository) GetInvitations(listID int) ([]Invitation, error) {
+	query := `SELECT id, email, role, created_at, expires_at FROM list_invitations
+		WHERE list_id = ? AND expires_at > ? ORDER BY created_at`
+	rows, err := r.db.Query(query, listID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invitations []Invitation
+
+	for rows.Next() {
+		invitation := Invitation{ListID: listID}
+
+		err := rows.Scan(&invitation.ID, &invitation.Email, &invitation.Role, &invitation.CreatedAt, &invitation.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+
+		invitations = append(invitations, invitation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+// Return the invitation of the token, or nil if it expired, was accepted or the list was deleted
+func (r *listInvitationRepository) GetInvitationByToken(tokenHash string) (*Invitation, error) {
+	query := `SELECT list_invitations.id, list_invitations.list_id, list_invitations.email, list_invitations.role,
+			list_invitations.created_at, list_invitations.expires_at, lists.name, owners.name
+		FROM list_invitations
+		JOIN lists ON lists.id = list_invitations.list_id
+		JOIN users owners ON owners.id = lists.user_id
+		WHERE list_invitations.token_hash = ? AND list_invitations.expires_at > ? AND lists.deleted_at IS NULL`
+	var invitation Invitation
+	err := r.db.QueryRow(query, tokenHash, time.Now().UTC()).Scan(&invitation.ID, &invitation.ListID, &invitation.Email,
+		&invitation.Role, &invitation.CreatedAt, &invitation.ExpiresAt, &invitation.ListName, &invitation.OwnerName)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// Make the user a member of the list and use up the invitation in one transaction
+func (r *listInvitationRepository) AcceptInvitation(invitation *Invitation, userID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Deleting first makes a second accept of the same link fail
+	res, err := tx.Exec("DELETE FROM list_invitations WHERE id = ?", invitation.ID)
+	if err != nil {
+		return err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return sql.ErrNoRows
+	}
+
+	query := "INSERT INTO list_members (list_id, user_id, role, created_at) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE role = VALUES(role)"
+	_, err = tx.Exec(query, invitation.ListID, userID, invitation.Role, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *listInvitationRepository) RevokeInvitation(listID, invitationID int) error {
+	query := "DELETE FROM list_invitations WHERE id = ? AND list_id = ?"
+	_, err := r.db.Exec(query, invitationID, listID)
+	return err
+}
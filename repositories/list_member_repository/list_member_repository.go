@@ -0,0 +1,93 @@
+package list_member_repository
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Roles of a user on a list, each role can do everything the previous one can
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleOwner  = "owner"
+)
+
+var roleRanks = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+// Check that role grants at least the permissions of required
+func HasRole(role, required string) bool {
+	return roleRanks[role] >= roleRanks[required] && roleRanks[required] > 0
+}
+
+// Only viewers and editors can be given to other users, a list has a single owner
+func IsValidMemberRole(role string) bool {
+	return role == RoleViewer || role == RoleEditor
+}
+
+type Member struct {
+	UserID int
+	Name   string
+	Email  string
+	Role   string
+}
+
+type ListMemberRepository interface {
+	GetMembers(listID int) ([]Member, error)
+	AddMember(listID, userID int, role string) error
+	RemoveMember(listID, userID int) error
+}
+
+type listMemberRepository struct {
+	db *sql.DB
+}
+
+func NewListMemberRepository(db *sql.DB) ListMemberRepository {
+	return &listMemberRepository{db}
+}
+
+func (r *listMemberRepository) GetMembers(listID int) ([]Member, error) {
+	query := `SELECT users.id, users.name, users.email, list_members.role
+		FROM list_members JOIN users ON users.id = list_members.user_id
+		WHERE list_members.list_id = ? ORDER BY users.name`
+	rows, err := r.db.Query(query, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []Member
+
+	for rows.Next() {
+		var member Member
+
+		err := rows.Scan(&member.UserID, &member.Name, &member.Email, &member.Role)
+		if err != nil {
+			return nil, err
+		}
+
+		members = append(members, member)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// Share the list with the user, or change the role if it is already shared
+func (r *listMemberRepository) AddMember(listID, userID int, role string) error {
+	query := "INSERT INTO list_members (list_id, user_id, role, created_at) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE role = VALUES(role)"
+	_, err := r.db.Exec(query, listID, userID, role, time.Now().UTC())
+	return err
+}
+
+func (r *listMemberRepository) RemoveMember(listID, userID int) error {
+	query := "DELETE FROM list_members WHERE list_id = ? AND user_id = ?"
+	_, err := r.db.Exec(query, listID, userID)
+	return err
+}
@@ -1,74 +1,900 @@
-package list_repository
-
-import (
-	"database/sql"
-
-	"github.com/Akhanrok/go_labs/repositories/product_repository"
-)
-
-type ListData struct {
-	ListName string
-	Products []product_repository.Product
-}
-
-type ListRepository interface {
-	IsListExists(userID int, listName string) (bool, error)
-	GetListsData(userID int) ([]ListData, error)
-}
-
-type listRepository struct {
-	db *sql.DB
-}
-
-func NewListRepository(db *sql.DB) ListRepository {
-	return &listRepository{db}
-}
-
-func (r *listRepository) IsListExists(userID int, listName string) (bool, error) {
-	query := "SELECT COUNT(*) FROM lists WHERE user_id = ? AND name = ?"
-	var count int
-	err := r.db.QueryRow(query, userID, listName).Scan(&count)
-	if err != nil {
-		return false, err
-	}
-	return count > 0, nil
-}
-
-func (r *listRepository) GetListsData(userID int) ([]ListData, error) {
-	query := "SELECT id, name FROM lists WHERE user_id = ?"
-	rows, err := r.db.Query(query, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var lists []ListData
-
-	for rows.Next() {
-		var listID int
-		var listName string
-
-		err := rows.Scan(&listID, &listName)
-		if err != nil {
-			return nil, err
-		}
-
-		products, err := product_repository.NewProductRepository(r.db).GetProductsData(listID)
-		if err != nil {
-			return nil, err
-		}
-
-		listData := ListData{
-			ListName: listName,
-			Products: products,
-		}
-
-		lists = append(lists, listData)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return lists, nil
-}
+package list_repository
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Akhanrok/go_labs/repositories/list_member_repository"
+	"github.com/Akhanrok/go_labs/repositories/product_repository"
+)
+
+// ErrVersionConflict is returned when the list was changed or deleted since it was loaded
+var ErrVersionConflict = errors.New("the list has been changed by someone else")
+
+type ListData struct {
+	ID       int
+	ListName string
+	Products []product_repository.Product
+	// DeletedAt is only set for lists in the trash
+	DeletedAt time.Time
+	// AutoArchive lists are archived once every product is purchased
+	AutoArchive bool
+	Archived    bool
+	// The owner of the list and the role of the user who loaded it
+	OwnerID   int
+	OwnerName string
+	Role      string
+	// Version increases with every saved change of the name or settings, products have their own
+	Version   int
+	CreatedAt time.Time
+}
+
+// Check that the user who loaded the list has at least the given role
+func (l ListData) HasRole(role string) bool {
+	return list_member_repository.HasRole(l.Role, role)
+}
+
+func (l ListData) IsShared() bool {
+	return l.Role != list_member_repository.RoleOwner
+}
+
+// ETag identifies the saved state of the list and its products for HTTP caching and If-Match
+func (l ListData) ETag() string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d:%d", l.ID, l.Version)
+	for _, product := range l.Products {
+		fmt.Fprintf(hash, ",%d:%d", product.ID, product.Version)
+	}
+	return `"` + hex.EncodeToString(hash.Sum(nil))[:16] + `"`
+}
+
+// Count the products already purchased
+func (l ListData) PurchasedCount() int {
+	count := 0
+	for _, product := range l.Products {
+		if product.Purchased {
+			count++
+		}
+	}
+	return count
+}
+
+type ListRepository interface {
+	IsListExists(userID int, listName string) (bool, error)
+	CreateList(userID int, listName string, products []product_repository.Product) (int, error)
+	GetListsData(userID int) ([]ListData, error)
+	GetListsPage(userID int, q ListsQuery) (*ListsPage, error)
+	GetList(userID, listID int) (*ListData, error)
+	AccessibleListIDs(userID int, listIDs []int) ([]int, error)
+	GetPublicList(listID int) (*ListData, error)
+	RenameList(userID, listID int, name string, version int) error
+	DeleteList(userID, listID int) error
+	GetDeletedLists(userID int) ([]ListData, error)
+	RestoreList(userID, listID int) error
+	PurgeList(userID, listID int) error
+	PurgeDeletedBefore(cutoff time.Time) (int64, error)
+	SetAutoArchive(userID, listID int, enabled bool, version int) error
+	ArchiveIfDone(listID int) (bool, error)
+	Unarchive(listID int) error
+	Search(userID int, terms []string) ([]ListData, error)
+	MergeLists(userID int, merge Merge) (int, error)
+}
+
+type listRepository struct {
+	db *sql.DB
+}
+
+func NewListRepository(db *sql.DB) ListRepository {
+	return &listRepository{db}
+}
+
+func (r *listRepository) IsListExists(userID int, listName string) (bool, error) {
+	query := "SELECT COUNT(*) FROM lists WHERE user_id = ? AND name = ? AND deleted_at IS NULL"
+	var count int
+	err := r.db.QueryRow(query, userID, listName).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Insert the list and its products in one transaction and return the ID of the list
+func (r *listRepository) CreateList(userID int, listName string, products []product_repository.Product) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO lists (user_id, name) VALUES (?, ?)", userID, listName)
+	if err != nil {
+		return 0, err
+	}
+
+	listID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertProducts(tx, listID, products, false)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return int(listID), nil
+}
+
+// Insert all products with a single statement. Unless keepPurchased is set the
+// products start as not purchased.
+func insertProducts(tx *sql.Tx, listID int64, products []product_repository.Product, keepPurchased bool) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(products))
+	args := make([]interface{}, 0, len(products)*5)
+	for i, product := range products {
+		var purchasedAt interface{}
+		if keepPurchased && product.Purchased {
+			purchasedAt = product.PurchasedAt
+			if product.PurchasedAt.IsZero() {
+				purchasedAt = time.Now().UTC()
+			}
+		}
+
+		placeholders[i] = "(?, ?, ?, ?, ?)"
+		args = append(args, listID, product.Product, product.Quantity, product.Store, purchasedAt)
+	}
+
+	query := "INSERT INTO products (list_id, name, quantity, store, purchased_at) VALUES " + strings.Join(placeholders, ", ")
+	_, err := tx.Exec(query, args...)
+	return err
+}
+
+// Lists the user owns or is a member of, with the role of the user on each list.
+// The columns and the rest of the query are kept apart so pages can select their sort key.
+const (
+	accessibleListsColumns = `SELECT lists.id, lists.name, lists.auto_archive, lists.archived_at IS NOT NULL,
+		lists.user_id, owners.name, IF(lists.user_id = ?, 'owner', list_members.role), lists.version, lists.created_at`
+	accessibleListsFrom = `
+	FROM lists
+	JOIN users owners ON owners.id = lists.user_id
+	LEFT JOIN list_members ON list_members.list_id = lists.id AND list_members.user_id = ?
+	WHERE lists.deleted_at IS NULL AND (lists.user_id = ? OR list_members.user_id IS NOT NULL)`
+	accessibleListsQuery = accessibleListsColumns + accessibleListsFrom
+)
+
+// Scan a row of accessibleListsQuery, extra holds the destinations of columns selected after the list
+func scanList(scanner interface{ Scan(...interface{}) error }, extra ...interface{}) (ListData, error) {
+	var list ListData
+	dest := []interface{}{&list.ID, &list.ListName, &list.AutoArchive, &list.Archived, &list.OwnerID, &list.OwnerName, &list.Role, &list.Version, &list.CreatedAt}
+	err := scanner.Scan(append(dest, extra...)...)
+	return list, err
+}
+
+// Return the lists of the user together with the lists shared with them
+func (r *listRepository) GetListsData(userID int) ([]ListData, error) {
+	query := accessibleListsQuery + " ORDER BY lists.id"
+	rows, err := r.db.Query(query, userID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lists []ListData
+
+	for rows.Next() {
+		listData, err := scanList(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		lists = append(lists, listData)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	return lists, r.loadProducts(lists)
+}
+
+// Load the products of all the lists with one query, after the rows of the lists are closed
+func (r *listRepository) loadProducts(lists []ListData) error {
+	listIDs := make([]int, len(lists))
+	for i, list := range lists {
+		listIDs[i] = list.ID
+	}
+
+	products, err := product_repository.NewProductRepository(r.db).GetProductsOfLists(listIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range lists {
+		lists[i].Products = products[lists[i].ID]
+	}
+	return nil
+}
+
+// Sort orders of the list views, prefixed with "-" they sort in descending order
+const (
+	SortName    = "name"
+	SortCreated = "created"
+	SortItems   = "items"
+)
+
+// The columns the lists are sorted by, the ID of the list breaks ties
+var sortKeys = map[string]string{
+	SortName:    "lists.name",
+	SortCreated: "lists.created_at",
+	SortItems:   "(SELECT COUNT(*) FROM products WHERE products.list_id = lists.id)",
+}
+
+const (
+	DefaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var (
+	// ErrInvalidSort is returned for a sort order that is not one of the Sort constants
+	ErrInvalidSort = errors.New("invalid sort order")
+	// ErrInvalidCursor is returned for a cursor that was not returned for the same sort order
+	ErrInvalidCursor = errors.New("invalid page cursor")
+)
+
+// Which page of the lists to load
+type ListsQuery struct {
+	// Sort is one of the Sort constants, optionally prefixed with "-"
+	Sort string
+	// Archived selects the archived lists instead of the active ones
+	Archived bool
+	// Cursor is the Next cursor of the previous page, empty for the first page
+	Cursor string
+	Limit  int
+}
+
+// A page of lists with the cursor of the next page, which is empty on the last page
+type ListsPage struct {
+	Lists []ListData
+	Next  string
+}
+
+// Return a page of the lists of the user and the lists shared with them. Pages are
+// selected by the sort key and ID of the last list of the previous page instead of
+// an offset, so lists created or deleted in between don't shift the following pages.
+func (r *listRepository) GetListsPage(userID int, q ListsQuery) (*ListsPage, error) {
+	key, ok := sortKeys[strings.TrimPrefix(q.Sort, "-")]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+	direction, compare := "ASC", ">"
+	if strings.HasPrefix(q.Sort, "-") {
+		direction, compare = "DESC", "<"
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	// The sort key is selected as text so the cursor can hold any of the keys
+	query := accessibleListsColumns + ", CAST(" + key + " AS CHAR)" + accessibleListsFrom +
+		" AND (lists.archived_at IS NOT NULL) = ?"
+	args := []interface{}{userID, userID, userID, q.Archived}
+
+	if q.Cursor != "" {
+		value, id, err := decodeCursor(q.Sort, q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		query += " AND (" + key + " " + compare + " ? OR (" + key + " = ? AND lists.id " + compare + " ?))"
+		args = append(args, value, value, id)
+	}
+
+	// One more list than needed tells whether there is a next page
+	query += " ORDER BY " + key + " " + direction + ", lists.id " + direction + " LIMIT " + strconv.Itoa(limit+1)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &ListsPage{}
+	var keys []string
+
+	for rows.Next() {
+		var value string
+		list, err := scanList(rows, &value)
+		if err != nil {
+			return nil, err
+		}
+
+		page.Lists = append(page.Lists, list)
+		keys = append(keys, value)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if len(page.Lists) > limit {
+		page.Lists = page.Lists[:limit]
+		page.Next = encodeCursor(q.Sort, keys[limit-1], page.Lists[limit-1].ID)
+	}
+
+	return page, r.loadProducts(page.Lists)
+}
+
+// The cursor holds the sort order it was made for, the sort key and the ID of the last list of a page
+func encodeCursor(sort, value string, id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(sort + "\n" + strconv.Itoa(id) + "\n" + value))
+}
+
+func decodeCursor(sort, cursor string) (string, int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", 0, ErrInvalidCursor
+	}
+
+	parts := strings.SplitN(string(decoded), "\n", 3)
+	if len(parts) != 3 || parts[0] != sort {
+		return "", 0, ErrInvalidCursor
+	}
+
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return "", 0, ErrInvalidCursor
+	}
+	return parts[2], id, nil
+}
+
+// Return the list with its products, or nil if the user neither owns the list nor is a member
+func (r *listRepository) GetList(userID, listID int) (*ListData, error) {
+	query := accessibleListsQuery + " AND lists.id = ?"
+	list, err := scanList(r.db.QueryRow(query, userID, userID, userID, listID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	list.Products, err = product_repository.NewProductRepository(r.db).GetProductsData(listID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+// Return the IDs among listIDs of the lists the user can see, with one query and without the products
+func (r *listRepository) AccessibleListIDs(userID int, listIDs []int) ([]int, error) {
+	if len(listIDs) == 0 {
+		return nil, nil
+	}
+
+	args := []interface{}{userID, userID}
+	for _, id := range listIDs {
+		args = append(args, id)
+	}
+	query := accessibleListIDsQuery + " AND lists.id IN (?" + strings.Repeat(", ?", len(listIDs)-1) + ")"
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// Return the list for a public share link, or nil if it was deleted.
+// The list is loaded with the viewer role.
+func (r *listRepository) GetPublicList(listID int) (*ListData, error) {
+	query := `SELECT lists.name, lists.archived_at IS NOT NULL, lists.user_id, owners.name, lists.version
+		FROM lists JOIN users owners ON owners.id = lists.user_id
+		WHERE lists.id = ? AND lists.deleted_at IS NULL`
+	list := ListData{ID: listID, Role: list_member_repository.RoleViewer}
+	err := r.db.QueryRow(query, listID).Scan(&list.ListName, &list.Archived, &list.OwnerID, &list.OwnerName, &list.Version)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	list.Products, err = product_repository.NewProductRepository(r.db).GetProductsData(listID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+// Rename the list if it still has the given version, the caller checks with IsListExists that the name is free
+func (r *listRepository) RenameList(userID, listID int, name string, version int) error {
+	query := "UPDATE lists SET name = ?, version = version + 1 WHERE id = ? AND user_id = ? AND deleted_at IS NULL AND version = ?"
+	res, err := r.db.Exec(query, name, listID, userID, version)
+	if err != nil {
+		return err
+	}
+	return checkVersion(res)
+}
+
+// Move the list to the trash
+func (r *listRepository) DeleteList(userID, listID int) error {
+	query := "UPDATE lists SET deleted_at = ? WHERE id = ? AND user_id = ? AND deleted_at IS NULL"
+	_, err := r.db.Exec(query, time.Now().UTC(), listID, userID)
+	return err
+}
+
+// Return the lists in the trash, most recently deleted first
+func (r *listRepository) GetDeletedLists(userID int) ([]ListData, error) {
+	query := "SELECT id, name, deleted_at FROM lists WHERE user_id = ? AND deleted_at IS NOT NULL ORDER BY deleted_at DESC"
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lists []ListData
+
+	for rows.Next() {
+		var list ListData
+
+		err := rows.Scan(&list.ID, &list.ListName, &list.DeletedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		lists = append(lists, list)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+// Take the list out of the trash, the caller checks with IsListExists that the name is free
+func (r *listRepository) RestoreList(userID, listID int) error {
+	query := "UPDATE lists SET deleted_at = NULL WHERE id = ? AND user_id = ?"
+	_, err := r.db.Exec(query, listID, userID)
+	return err
+}
+
+// Permanently delete a list from the trash together with its products
+func (r *listRepository) PurgeList(userID, listID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE products FROM products JOIN lists ON lists.id = products.list_id
+		WHERE lists.id = ? AND lists.user_id = ? AND lists.deleted_at IS NOT NULL`, listID, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM lists WHERE id = ? AND user_id = ? AND deleted_at IS NOT NULL", listID, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Permanently delete every list that was moved to the trash before cutoff, returns the number of lists
+func (r *listRepository) PurgeDeletedBefore(cutoff time.Time) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE products FROM products JOIN lists ON lists.id = products.list_id
+		WHERE lists.deleted_at IS NOT NULL AND lists.deleted_at < ?`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec("DELETE FROM lists WHERE deleted_at IS NOT NULL AND deleted_at < ?", cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, tx.Commit()
+}
+
+func (r *listRepository) SetAutoArchive(userID, listID int, enabled bool, version int) error {
+	query := "UPDATE lists SET auto_archive = ?, version = version + 1 WHERE id = ? AND user_id = ? AND deleted_at IS NULL AND version = ?"
+	res, err := r.db.Exec(query, enabled, listID, userID, version)
+	if err != nil {
+		return err
+	}
+	return checkVersion(res)
+}
+
+// Archive an auto-archiving list when it has products and all of them are purchased,
+// returns whether the list was archived
+func (r *listRepository) ArchiveIfDone(listID int) (bool, error) {
+	query := `UPDATE lists SET archived_at = ?
+		WHERE id = ? AND auto_archive AND archived_at IS NULL
+		AND EXISTS (SELECT 1 FROM products WHERE list_id = ?)
+		AND NOT EXISTS (SELECT 1 FROM products WHERE list_id = ? AND purchased_at IS NULL)`
+	res, err := r.db.Exec(query, time.Now().UTC(), listID, listID, listID)
+	if err != nil {
+		return false, err
+	}
+
+	archived, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return archived > 0, nil
+}
+
+func (r *listRepository) Unarchive(listID int) error {
+	query := "UPDATE lists SET archived_at = NULL WHERE id = ?"
+	_, err := r.db.Exec(query, listID)
+	return err
+}
+
+// A versioned statement that changed nothing found a newer version, or no list at all
+func checkVersion(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+const (
+	// MySQL ignores shorter words in FULLTEXT indexes by default (innodb_ft_min_token_size)
+	minFulltextTermLength = 3
+	// Products returned by one search
+	maxSearchProducts = 500
+)
+
+// Whether the database has the FULLTEXT indexes of the search. Migrations skip them on
+// databases that do not support them, so this is looked up once and then remembered.
+var fulltext struct {
+	mu        sync.Mutex
+	checked   bool
+	available bool
+}
+
+func (r *listRepository) hasFulltextIndexes() (bool, error) {
+	fulltext.mu.Lock()
+	defer fulltext.mu.Unlock()
+
+	if !fulltext.checked {
+		var count int
+		err := r.db.QueryRow(`SELECT COUNT(DISTINCT INDEX_NAME) FROM information_schema.STATISTICS
+			WHERE TABLE_SCHEMA = DATABASE() AND INDEX_TYPE = 'FULLTEXT'
+			AND INDEX_NAME IN ('ft_lists_name', 'ft_products_name_store')`).Scan(&count)
+		if err != nil {
+			return false, err
+		}
+		fulltext.checked = true
+		fulltext.available = count == 2
+	}
+
+	return fulltext.available, nil
+}
+
+// IDs of the lists the user owns or is a member of
+const accessibleListIDsQuery = `SELECT lists.id FROM lists
+	LEFT JOIN list_members ON list_members.list_id = lists.id AND list_members.user_id = ?
+	WHERE lists.deleted_at IS NULL AND (lists.user_id = ? OR list_members.user_id IS NOT NULL)`
+
+// Find the lists the user can see whose name contains every term, or that have products
+// whose name or store contain every term. Products of the returned lists are only the matching ones.
+// The terms are words of letters and digits, matching is case-insensitive. FULLTEXT indexes are used
+// when they exist and find something, LIKE finds words inside other words and short words as well.
+func (r *listRepository) Search(userID int, terms []string) ([]ListData, error) {
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	useFulltext, err := r.hasFulltextIndexes()
+	if err != nil {
+		return nil, err
+	}
+	for _, term := range terms {
+		if len([]rune(term)) < minFulltextTermLength {
+			useFulltext = false
+		}
+	}
+
+	if useFulltext {
+		lists, err := r.search(userID, fulltextConditions(terms))
+		if err != nil || len(lists) > 0 {
+			return lists, err
+		}
+	}
+
+	return r.search(userID, likeConditions(terms))
+}
+
+// WHERE conditions of a search on the list names and on the products, with their arguments,
+// and the relevance of a product that decides which products are kept when there are too many
+type searchConditions struct {
+	list             string
+	listArgs         []interface{}
+	product          string
+	productArgs      []interface{}
+	productScore     string
+	productScoreArgs []interface{}
+}
+
+func fulltextConditions(terms []string) searchConditions {
+	// Every term is required, and also matches longer words it starts
+	words := make([]string, len(terms))
+	for i, term := range terms {
+		words[i] = "+" + term + "*"
+	}
+	against := strings.Join(words, " ")
+
+	return searchConditions{
+		list:             "MATCH(lists.name) AGAINST (? IN BOOLEAN MODE)",
+		listArgs:         []interface{}{against},
+		product:          "MATCH(products.name, products.store) AGAINST (? IN BOOLEAN MODE)",
+		productArgs:      []interface{}{against},
+		productScore:     "MATCH(products.name, products.store) AGAINST (? IN BOOLEAN MODE)",
+		productScoreArgs: []interface{}{against},
+	}
+}
+
+// Score of one term in the product name, the term is known to be in the name or the store
+const likeScore = `CASE WHEN CONCAT(' ', products.name, ' ') LIKE ? THEN 3
+	WHEN CONCAT(' ', products.name) LIKE ? THEN 2 ELSE 1 END`
+
+func likeConditions(terms []string) searchConditions {
+	var c searchConditions
+	var list, product, score []string
+	for _, term := range terms {
+		// Terms hold no LIKE wildcards, they are letters and digits only
+		pattern := "%" + term + "%"
+		list = append(list, "lists.name LIKE ?")
+		c.listArgs = append(c.listArgs, pattern)
+		product = append(product, "(products.name LIKE ? OR products.store LIKE ?)")
+		c.productArgs = append(c.productArgs, pattern, pattern)
+
+		// Like search_service.Score, a whole word counts most, the start of a word less
+		// and a match inside a word least
+		score = append(score, "GREATEST("+likeScore+", "+strings.ReplaceAll(likeScore, "products.name", "products.store")+")")
+		c.productScoreArgs = append(c.productScoreArgs, "% "+term+" %", "% "+term+"%", "% "+term+" %", "% "+term+"%")
+	}
+	c.list = strings.Join(list, " AND ")
+	c.product = strings.Join(product, " AND ")
+	c.productScore = strings.Join(score, " + ")
+	return c
+}
+
+func (r *listRepository) search(userID int, c searchConditions) ([]ListData, error) {
+	// The best matches are kept when there are more products than one search returns
+	query := `SELECT list_id, id, name, quantity, store, purchased_at, version FROM products
+		WHERE list_id IN (` + accessibleListIDsQuery + `) AND ` + c.product + `
+		ORDER BY ` + c.productScore + ` DESC, list_id, id LIMIT ` + strconv.Itoa(maxSearchProducts)
+	args := append([]interface{}{userID, userID}, c.productArgs...)
+	args = append(args, c.productScoreArgs...)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := map[int][]product_repository.Product{}
+	var listIDs []interface{}
+
+	for rows.Next() {
+		var listID int
+		var product product_repository.Product
+		var purchasedAt sql.NullTime
+
+		err := rows.Scan(&listID, &product.ID, &product.Product, &product.Quantity, &product.Store, &purchasedAt, &product.Version)
+		if err != nil {
+			return nil, err
+		}
+		product.Purchased = purchasedAt.Valid
+		product.PurchasedAt = purchasedAt.Time
+
+		if _, ok := products[listID]; !ok {
+			listIDs = append(listIDs, listID)
+		}
+		products[listID] = append(products[listID], product)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Lists whose name matches, and the lists of the matching products
+	condition := c.list
+	args = append([]interface{}{userID, userID, userID}, c.listArgs...)
+	if len(listIDs) > 0 {
+		condition += " OR lists.id IN (?" + strings.Repeat(", ?", len(listIDs)-1) + ")"
+		args = append(args, listIDs...)
+	}
+
+	listRows, err := r.db.Query(accessibleListsQuery+" AND ("+condition+") ORDER BY lists.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer listRows.Close()
+
+	var lists []ListData
+
+	for listRows.Next() {
+		list, err := scanList(listRows)
+		if err != nil {
+			return nil, err
+		}
+		list.Products = products[list.ID]
+
+		lists = append(lists, list)
+	}
+
+	if err := listRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+// A new list made of the products of other lists. Sources has the ETag of every
+// list as it was when the products were merged.
+type Merge struct {
+	Name          string
+	Products      []product_repository.Product
+	Sources       map[int]string
+	DeleteSources bool
+}
+
+// Create the merged list and, if asked, move the source lists the user owns to the trash,
+// all in one transaction. The source lists are locked and ErrVersionConflict is returned
+// if one of them was changed or deleted since the products were merged.
+func (r *listRepository) MergeLists(userID int, merge Merge) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	sourceIDs := make([]interface{}, 0, len(merge.Sources))
+	for id := range merge.Sources {
+		sourceIDs = append(sourceIDs, id)
+	}
+	if len(sourceIDs) == 0 {
+		return 0, errors.New("nothing to merge")
+	}
+	in := "(?" + strings.Repeat(", ?", len(sourceIDs)-1) + ")"
+
+	sources, err := lockSources(tx, in, sourceIDs)
+	if err != nil {
+		return 0, err
+	}
+	for id, etag := range merge.Sources {
+		source, ok := sources[id]
+		if !ok || source.ETag() != etag {
+			return 0, ErrVersionConflict
+		}
+	}
+
+	res, err := tx.Exec("INSERT INTO lists (user_id, name) VALUES (?, ?)", userID, merge.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	listID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertProducts(tx, listID, merge.Products, true)
+	if err != nil {
+		return 0, err
+	}
+
+	// Lists shared with the user are left to their owners
+	if merge.DeleteSources {
+		query := "UPDATE lists SET deleted_at = ? WHERE id IN " + in + " AND user_id = ? AND deleted_at IS NULL"
+		args := append(append([]interface{}{time.Now().UTC()}, sourceIDs...), userID)
+		_, err = tx.Exec(query, args...)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return int(listID), nil
+}
+
+// Lock the lists and their products until the transaction ends and return them with
+// the versions the ETags are made of
+func lockSources(tx *sql.Tx, in string, ids []interface{}) (map[int]*ListData, error) {
+	rows, err := tx.Query("SELECT id, version FROM lists WHERE id IN "+in+" AND deleted_at IS NULL FOR UPDATE", ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := map[int]*ListData{}
+	for rows.Next() {
+		list := &ListData{}
+		if err := rows.Scan(&list.ID, &list.Version); err != nil {
+			return nil, err
+		}
+		lists[list.ID] = list
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	productRows, err := tx.Query("SELECT list_id, id, version FROM products WHERE list_id IN "+in+" ORDER BY list_id, id FOR UPDATE", ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer productRows.Close()
+
+	for productRows.Next() {
+		var listID int
+		var product product_repository.Product
+		if err := productRows.Scan(&listID, &product.ID, &product.Version); err != nil {
+			return nil, err
+		}
+		if list, ok := lists[listID]; ok {
+			list.Products = append(list.Products, product)
+		}
+	}
+
+	return lists, productRows.Err()
+}
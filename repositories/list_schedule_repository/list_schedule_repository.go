@@ -0,0 +1,218 @@
+package list_schedule_repository
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+// Schedule recreates a list on the days given by an RRULE
+type Schedule struct {
+	ID       int
+	ListID   int
+	ListName string
+	Rule     string
+	// StartsOn is the day the rule counts from
+	StartsOn time.Time
+	// CarryOver moves the products not purchased on the previous generated list to the new one
+	CarryOver bool
+	// NextRunAt is the next occurrence, the list for it has not been generated yet
+	NextRunAt time.Time
+	// LastListID is the list generated last, 0 before the first one or after it was purged
+	LastListID   int
+	LastListName string
+}
+
+type ListScheduleRepository interface {
+	SetSchedule(listID int, rule string, startsOn time.Time, carryOver bool, nextRunAt time.Time) error
+	RemoveSchedule(listID int) error
+	GetSchedule(listID int) (*Schedule, error)
+	GetSchedules(userID int) ([]Schedule, error)
+	GetDueSchedules(now time.Time) ([]Schedule, error)
+	Generate(schedule Schedule, name string, nextRunAt time.Time) (int, error)
+}
+
+type listScheduleRepository struct {
+	db *sql.DB
+}
+
+func NewListScheduleRepository(db *sql.DB) ListScheduleRepository {
+	return &listScheduleRepository{db}
+}
+
+const scheduleQuery = `SELECT list_schedules.id, list_schedules.list_id, lists.name, list_schedules.rule,
+		list_schedules.starts_on, list_schedules.carry_over, list_schedules.next_run_at,
+		COALESCE(last_lists.id, 0), COALESCE(last_lists.name, '')
+	FROM list_schedules
+	JOIN lists ON lists.id = list_schedules.list_id
+	LEFT JOIN lists last_lists ON last_lists.id = list_schedules.last_list_id AND last_lists.deleted_at IS NULL
+	WHERE lists.deleted_at IS NULL`
+
+func scanSchedule(scanner interface{ Scan(...interface{}) error }) (Schedule, error) {
+	var schedule Schedule
+	err := scanner.Scan(&schedule.ID, &schedule.ListID, &schedule.ListName, &schedule.Rule,
+		&schedule.StartsOn, &schedule.CarryOver, &schedule.NextRunAt, &schedule.LastListID, &schedule.LastListName)
+	return schedule, err
+}
+
+// Create the schedule of the list or replace its rule, the last generated list is kept for carrying over
+func (r *listScheduleRepository) SetSchedule(listID int, rule string, startsOn time.Time, carryOver bool, nextRunAt time.Time) error {
+	query := `INSERT INTO list_schedules (list_id, rule, starts_on, carry_over, next_run_at) VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE rule = VALUES(rule), starts_on = VALUES(starts_on),
+			carry_over = VALUES(carry_over), next_run_at = VALUES(next_run_at)`
+	_, err := r.db.Exec(query, listID, rule, startsOn.Format("2006-01-02"), carryOver, nextRunAt.UTC())
+	return err
+}
+
+func (r *listScheduleRepository) RemoveSchedule(listID int) error {
+	_, err := r.db.Exec("DELETE FROM list_schedules WHERE list_id = ?", listID)
+	return err
+}
+
+// Return the schedule of the list, or nil if it does not recur
+func (r *listScheduleRepository) GetSchedule(listID int) (*Schedule, error) {
+	schedule, err := scanSchedule(r.db.QueryRow(scheduleQuery+" AND list_schedules.list_id = ?", listID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// Return the schedules of the lists the user owns, the next one due first
+func (r *listScheduleRepository) GetSchedules(userID int) ([]Schedule, error) {
+	return r.querySchedules(scheduleQuery+" AND lists.user_id = ? ORDER BY list_schedules.next_run_at", userID)
+}
+
+// Return the schedules whose next occurrence is not later than now
+func (r *listScheduleRepository) GetDueSchedules(now time.Time) ([]Schedule, error) {
+	return r.querySchedules(scheduleQuery+" AND list_schedules.next_run_at <= ? ORDER BY list_schedules.next_run_at", now.UTC())
+}
+
+func (r *listScheduleRepository) querySchedules(query string, args ...interface{}) ([]Schedule, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []Schedule
+
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		schedules = append(schedules, schedule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+// Generate the list for schedule.NextRunAt and move the schedule on to nextRunAt, all in one
+// transaction. The occurrence is claimed first, so when it was already generated, by an earlier
+// run or another server, nothing happens and 0 is returned. Otherwise the ID of the new list is returned.
+func (r *listScheduleRepository) Generate(schedule Schedule, name string, nextRunAt time.Time) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Claiming the occurrence also locks the schedule until the transaction ends
+	res, err := tx.Exec("UPDATE list_schedules SET next_run_at = ? WHERE id = ? AND next_run_at = ?",
+		nextRunAt.UTC(), schedule.ID, schedule.NextRunAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+	claimed, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if claimed == 0 {
+		return 0, nil
+	}
+
+	var ownerID int
+	var autoArchive bool
+	err = tx.QueryRow("SELECT user_id, auto_archive FROM lists WHERE id = ? AND deleted_at IS NULL", schedule.ListID).Scan(&ownerID, &autoArchive)
+	if err == sql.ErrNoRows {
+		// Lists in the trash do not recur, but the schedule is kept for a restore
+		return 0, tx.Commit()
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	name, err = uniqueListName(tx, ownerID, name)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err = tx.Exec("INSERT INTO lists (user_id, name, auto_archive) VALUES (?, ?, ?)", ownerID, name, autoArchive)
+	if err != nil {
+		return 0, err
+	}
+	listID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`INSERT INTO products (list_id, name, quantity, store)
+		SELECT ?, name, quantity, store FROM products WHERE list_id = ? ORDER BY id`, listID, schedule.ListID)
+	if err != nil {
+		return 0, err
+	}
+
+	if schedule.CarryOver && schedule.LastListID != 0 {
+		// Move what was not purchased, unless the new list has the same product from the same store already
+		_, err = tx.Exec(`UPDATE products SET list_id = ?, version = version + 1
+			WHERE list_id = ? AND purchased_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM (SELECT name, store FROM products WHERE list_id = ?) copied
+				WHERE copied.name = products.name AND copied.store = products.store)`,
+			listID, schedule.LastListID, listID)
+		if err != nil {
+			return 0, err
+		}
+
+		// What is left unpurchased is on the new list as well
+		_, err = tx.Exec("DELETE FROM products WHERE list_id = ? AND purchased_at IS NULL", schedule.LastListID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec("UPDATE list_schedules SET last_list_id = ? WHERE id = ?", listID, schedule.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return int(listID), nil
+}
+
+// Add a number to the name while the owner has an active list with it
+func uniqueListName(tx *sql.Tx, userID int, name string) (string, error) {
+	candidate := name
+	for i := 2; ; i++ {
+		var count int
+		err := tx.QueryRow("SELECT COUNT(*) FROM lists WHERE user_id = ? AND name = ? AND deleted_at IS NULL", userID, candidate).Scan(&count)
+		if err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = name + " (" + strconv.Itoa(i) + ")"
+	}
+}
@@ -0,0 +1,184 @@
+package list_template_repository
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/Akhanrok/go_labs/repositories/product_repository"
+)
+
+// A named set of products a user creates new lists from
+type Template struct {
+	ID        int
+	Name      string
+	CreatedAt time.Time
+	Items     []product_repository.Product
+}
+
+type ListTemplateRepository interface {
+	IsTemplateExists(userID int, name string) (bool, error)
+	CreateTemplate(userID int, name string, items []product_repository.Product) (int, error)
+	GetTemplates(userID int) ([]Template, error)
+	GetTemplate(userID, templateID int) (*Template, error)
+	DeleteTemplate(userID, templateID int) error
+}
+
+type listTemplateRepository struct {
+	db *sql.DB
+}
+
+func NewListTemplateRepository(db *sql.DB) ListTemplateRepository {
+	return &listTemplateRepository{db}
+}
+
+func (r *listTemplateRepository) IsTemplateExists(userID int, name string) (bool, error) {
+	query := "SELECT COUNT(*) FROM list_templates WHERE user_id = ? AND name = ?"
+	var count int
+	err := r.db.QueryRow(query, userID, name).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Insert the template and its items in one transaction and return the ID of the template.
+// Only the name, quantity and store of the items are kept.
+func (r *listTemplateRepository) CreateTemplate(userID int, name string, items []product_repository.Product) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO list_templates (user_id, name, created_at) VALUES (?, ?, ?)", userID, name, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	templateID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(items) > 0 {
+		placeholders := make([]string, len(items))
+		args := make([]interface{}, 0, len(items)*4)
+		for i, item := range items {
+			placeholders[i] = "(?, ?, ?, ?)"
+			args = append(args, templateID, item.Product, item.Quantity, item.Store)
+		}
+
+		query := "INSERT INTO list_template_items (template_id, name, quantity, store) VALUES " + strings.Join(placeholders, ", ")
+		_, err = tx.Exec(query, args...)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return int(templateID), nil
+}
+
+// Return the templates of the user by name, with their items
+func (r *listTemplateRepository) GetTemplates(userID int) ([]Template, error) {
+	rows, err := r.db.Query("SELECT id, name, created_at FROM list_templates WHERE user_id = ? ORDER BY name", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []Template
+	positions := map[int]int{}
+
+	for rows.Next() {
+		var template Template
+
+		err := rows.Scan(&template.ID, &template.Name, &template.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		positions[template.ID] = len(templates)
+		templates = append(templates, template)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The items of all templates are loaded with one query
+	itemRows, err := r.db.Query(`SELECT items.template_id, items.id, items.name, items.quantity, items.store
+		FROM list_template_items items JOIN list_templates ON list_templates.id = items.template_id
+		WHERE list_templates.user_id = ? ORDER BY items.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer itemRows.Close()
+
+	for itemRows.Next() {
+		var templateID int
+		var item product_repository.Product
+
+		err := itemRows.Scan(&templateID, &item.ID, &item.Product, &item.Quantity, &item.Store)
+		if err != nil {
+			return nil, err
+		}
+
+		if i, ok := positions[templateID]; ok {
+			templates[i].Items = append(templates[i].Items, item)
+		}
+	}
+
+	if err := itemRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+// Return the template with its items, or nil if the user has no such template
+func (r *listTemplateRepository) GetTemplate(userID, templateID int) (*Template, error) {
+	template := Template{ID: templateID}
+	query := "SELECT name, created_at FROM list_templates WHERE id = ? AND user_id = ?"
+	err := r.db.QueryRow(query, templateID, userID).Scan(&template.Name, &template.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query("SELECT id, name, quantity, store FROM list_template_items WHERE template_id = ? ORDER BY id", templateID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item product_repository.Product
+
+		err := rows.Scan(&item.ID, &item.Product, &item.Quantity, &item.Store)
+		if err != nil {
+			return nil, err
+		}
+
+		template.Items = append(template.Items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &template, nil
+}
+
+// Delete the template, its items are removed by the foreign key
+func (r *listTemplateRepository) DeleteTemplate(userID, templateID int) error {
+	query := "DELETE FROM list_templates WHERE id = ? AND user_id = ?"
+	_, err := r.db.Exec(query, templateID, userID)
+	return err
+}
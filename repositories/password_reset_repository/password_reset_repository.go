@@ -0,0 +1,76 @@
+package password_reset_repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type PasswordResetRepository interface {
+	CreateReset(userID int, tokenHash string, expiresAt time.Time) error
+	IsResetValid(tokenHash string) (bool, error)
+	ConsumeReset(tokenHash string) (int, error)
+}
+
+type passwordResetRepository struct {
+	db *sql.DB
+}
+
+func NewPasswordResetRepository(db *sql.DB) PasswordResetRepository {
+	return &passwordResetRepository{db}
+}
+
+func (r *passwordResetRepository) CreateReset(userID int, tokenHash string, expiresAt time.Time) error {
+	query := "INSERT INTO password_resets (user_id, token_hash, created_at, expires_at) VALUES (?, ?, ?, ?)"
+	_, err := r.db.Exec(query, userID, tokenHash, time.Now().UTC(), expiresAt.UTC())
+	return err
+}
+
+func (r *passwordResetRepository) IsResetValid(tokenHash string) (bool, error) {
+	query := "SELECT COUNT(*) FROM password_resets WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?"
+	var count int
+	err := r.db.QueryRow(query, tokenHash, time.Now().UTC()).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Mark the reset as used and return its user ID, or 0 if the token is unknown, used or expired
+func (r *passwordResetRepository) ConsumeReset(tokenHash string) (int, error) {
+	now := time.Now().UTC()
+
+	query := "SELECT id, user_id FROM password_resets WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?"
+	var resetID, userID int
+	err := r.db.QueryRow(query, tokenHash, now).Scan(&resetID, &userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// The used_at condition makes sure only one of two concurrent requests redeems the token
+	updateQuery := "UPDATE password_resets SET used_at = ? WHERE id = ? AND used_at IS NULL"
+	res, err := r.db.Exec(updateQuery, now, resetID)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if affected == 0 {
+		return 0, nil
+	}
+
+	// Tokens issued earlier for the same user cannot be used anymore
+	invalidateQuery := "UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL"
+	_, err = r.db.Exec(invalidateQuery, now, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
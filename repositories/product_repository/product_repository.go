@@ -1,59 +1,185 @@
-package product_repository
-
-import (
-	"database/sql"
-)
-
-type Product struct {
-	Product  string
-	Quantity int
-	Store    string
-}
-
-type ProductRepository interface {
-	GetProductsData(listID int) ([]Product, error)
-}
-
-type productRepository struct {
-	db *sql.DB
-}
-
-func NewProductRepository(db *sql.DB) ProductRepository {
-	return &productRepository{db}
-}
-
-func (r *productRepository) GetProductsData(listID int) ([]Product, error) {
-	query := "SELECT name, quantity, store FROM products WHERE list_id = ?"
-	rows, err := r.db.Query(query, listID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var products []Product
-
-	for rows.Next() {
-		var name string
-		var quantity int
-		var store string
-
-		err := rows.Scan(&name, &quantity, &store)
-		if err != nil {
-			return nil, err
-		}
-
-		product := Product{
-			Product:  name,
-			Quantity: quantity,
-			Store:    store,
-		}
-
-		products = append(products, product)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return products, nil
-}
+package product_repository
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrVersionConflict is returned when the product was changed or removed since it was loaded
+var ErrVersionConflict = errors.New("the product has been changed by someone else")
+
+type Product struct {
+	ID       int
+	Product  string
+	Quantity int
+	Store    string
+	// Purchased products have been put in the cart at PurchasedAt
+	Purchased   bool
+	PurchasedAt time.Time
+	// Version increases with every saved change of the product
+	Version int
+}
+
+type ProductRepository interface {
+	GetProductsData(listID int) ([]Product, error)
+	GetProductsOfLists(listIDs []int) (map[int][]Product, error)
+	AddProduct(listID int, product Product) (int, error)
+	UpdateProduct(listID int, product Product) error
+	RemoveProduct(listID, productID, version int) error
+	SetPurchased(listID, productID int, purchased bool) error
+}
+
+type productRepository struct {
+	db *sql.DB
+}
+
+func NewProductRepository(db *sql.DB) ProductRepository {
+	return &productRepository{db}
+}
+
+func (r *productRepository) GetProductsData(listID int) ([]Product, error) {
+	query := "SELECT id, name, quantity, store, purchased_at, version FROM products WHERE list_id = ? ORDER BY id"
+	rows, err := r.db.Query(query, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []Product
+
+	for rows.Next() {
+		var id int
+		var name string
+		var quantity int
+		var store string
+		var purchasedAt sql.NullTime
+		var version int
+
+		err := rows.Scan(&id, &name, &quantity, &store, &purchasedAt, &version)
+		if err != nil {
+			return nil, err
+		}
+
+		product := Product{
+			ID:          id,
+			Product:     name,
+			Quantity:    quantity,
+			Store:       store,
+			Purchased:   purchasedAt.Valid,
+			PurchasedAt: purchasedAt.Time,
+			Version:     version,
+		}
+
+		products = append(products, product)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+// Load the products of several lists with one query, grouped by the ID of the list
+func (r *productRepository) GetProductsOfLists(listIDs []int) (map[int][]Product, error) {
+	products := map[int][]Product{}
+	if len(listIDs) == 0 {
+		return products, nil
+	}
+
+	args := make([]interface{}, len(listIDs))
+	for i, id := range listIDs {
+		args[i] = id
+	}
+	query := `SELECT list_id, id, name, quantity, store, purchased_at, version FROM products
+		WHERE list_id IN (?` + strings.Repeat(", ?", len(listIDs)-1) + `) ORDER BY list_id, id`
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var listID int
+		var product Product
+		var purchasedAt sql.NullTime
+
+		err := rows.Scan(&listID, &product.ID, &product.Product, &product.Quantity, &product.Store, &purchasedAt, &product.Version)
+		if err != nil {
+			return nil, err
+		}
+		product.Purchased = purchasedAt.Valid
+		product.PurchasedAt = purchasedAt.Time
+
+		products[listID] = append(products[listID], product)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+// Add a product to the list and return its ID
+func (r *productRepository) AddProduct(listID int, product Product) (int, error) {
+	query := "INSERT INTO products (list_id, name, quantity, store) VALUES (?, ?, ?, ?)"
+	res, err := r.db.Exec(query, listID, product.Product, product.Quantity, product.Store)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// Update the product with product.ID if it still has product.Version, products of other lists are left untouched
+func (r *productRepository) UpdateProduct(listID int, product Product) error {
+	query := "UPDATE products SET name = ?, quantity = ?, store = ?, version = version + 1 WHERE id = ? AND list_id = ? AND version = ?"
+	res, err := r.db.Exec(query, product.Product, product.Quantity, product.Store, product.ID, listID, product.Version)
+	if err != nil {
+		return err
+	}
+	return checkVersion(res)
+}
+
+// Remove the product unless it was changed after the given version
+func (r *productRepository) RemoveProduct(listID, productID, version int) error {
+	query := "DELETE FROM products WHERE id = ? AND list_id = ? AND version = ?"
+	res, err := r.db.Exec(query, productID, listID, version)
+	if err != nil {
+		return err
+	}
+	return checkVersion(res)
+}
+
+// Check the product off or put it back on the list. Both mean the same whoever does it first,
+// so the version is increased without being checked.
+func (r *productRepository) SetPurchased(listID, productID int, purchased bool) error {
+	var purchasedAt sql.NullTime
+	if purchased {
+		purchasedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	}
+
+	// Keep the original time when a purchased product is checked again
+	query := "UPDATE products SET purchased_at = IF(? AND purchased_at IS NOT NULL, purchased_at, ?), version = version + 1 WHERE id = ? AND list_id = ?"
+	_, err := r.db.Exec(query, purchased, purchasedAt, productID, listID)
+	return err
+}
+
+// A versioned statement that changed nothing found a newer version, or no product at all
+func checkVersion(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
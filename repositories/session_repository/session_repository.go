@@ -0,0 +1,161 @@
+package session_repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type Session struct {
+	ID         string
+	UserID     int
+	Data       []byte
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+}
+
+type SessionRepository interface {
+	GetSession(id string) (*Session, error)
+	SaveSession(session Session) error
+	ReplaceSession(oldID string, session Session) error
+	TouchSession(id string, lastSeenAt time.Time) error
+	DeleteSession(id string) error
+	GetUserSessions(userID int) ([]Session, error)
+	DeleteUserSession(userID int, id string) error
+	DeleteOtherUserSessions(userID int, keepID string) error
+	DeleteExpiredSessions() (int64, error)
+}
+
+type sessionRepository struct {
+	db *sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) SessionRepository {
+	return &sessionRepository{db}
+}
+
+// Return the session with the given ID or nil if it does not exist or has expired
+func (r *sessionRepository) GetSession(id string) (*Session, error) {
+	query := `SELECT id, COALESCE(user_id, 0), data, user_agent, ip, created_at, last_seen_at, expires_at
+		FROM sessions WHERE id = ? AND expires_at > ?`
+	var s Session
+	err := r.db.QueryRow(query, id, time.Now().UTC()).Scan(
+		&s.ID, &s.UserID, &s.Data, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *sessionRepository) SaveSession(s Session) error {
+	return saveSession(r.db, s)
+}
+
+// Store the session under its new ID and delete the row of the old ID in one transaction
+func (r *sessionRepository) ReplaceSession(oldID string, s Session) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM sessions WHERE id = ?", oldID)
+	if err != nil {
+		return err
+	}
+
+	err = saveSession(tx, s)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// The database or a transaction
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func saveSession(db execer, s Session) error {
+	var userID sql.NullInt64
+	if s.UserID != 0 {
+		userID = sql.NullInt64{Int64: int64(s.UserID), Valid: true}
+	}
+
+	query := `INSERT INTO sessions (id, user_id, data, user_agent, ip, created_at, last_seen_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE user_id = VALUES(user_id), data = VALUES(data), user_agent = VALUES(user_agent),
+			ip = VALUES(ip), last_seen_at = VALUES(last_seen_at), expires_at = VALUES(expires_at)`
+	_, err := db.Exec(query, s.ID, userID, s.Data, s.UserAgent, s.IP, s.CreatedAt, s.LastSeenAt, s.ExpiresAt)
+	return err
+}
+
+func (r *sessionRepository) TouchSession(id string, lastSeenAt time.Time) error {
+	query := "UPDATE sessions SET last_seen_at = ? WHERE id = ?"
+	_, err := r.db.Exec(query, lastSeenAt, id)
+	return err
+}
+
+func (r *sessionRepository) DeleteSession(id string) error {
+	query := "DELETE FROM sessions WHERE id = ?"
+	_, err := r.db.Exec(query, id)
+	return err
+}
+
+// Return the active sessions of the user, the most recently used first
+func (r *sessionRepository) GetUserSessions(userID int) ([]Session, error) {
+	query := `SELECT id, user_id, user_agent, ip, created_at, last_seen_at, expires_at
+		FROM sessions WHERE user_id = ? AND expires_at > ? ORDER BY last_seen_at DESC`
+	rows, err := r.db.Query(query, userID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+
+	for rows.Next() {
+		var s Session
+
+		err := rows.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (r *sessionRepository) DeleteUserSession(userID int, id string) error {
+	query := "DELETE FROM sessions WHERE user_id = ? AND id = ?"
+	_, err := r.db.Exec(query, userID, id)
+	return err
+}
+
+func (r *sessionRepository) DeleteOtherUserSessions(userID int, keepID string) error {
+	query := "DELETE FROM sessions WHERE user_id = ? AND id <> ?"
+	_, err := r.db.Exec(query, userID, keepID)
+	return err
+}
+
+func (r *sessionRepository) DeleteExpiredSessions() (int64, error) {
+	query := "DELETE FROM sessions WHERE expires_at <= ?"
+	res, err := r.db.Exec(query, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,97 @@
+package share_link_repository
+
+import (
+	"database/sql"
+	"time"
+)
+
+type ShareLink struct {
+	ID     int
+	ListID int
+	// TokenHint is the start of the token, enough to tell links apart
+	TokenHint string
+	CreatedAt time.Time
+	// ExpiresAt is zero for links that never expire
+	ExpiresAt time.Time
+}
+
+type ShareLinkRepository interface {
+	CreateLink(listID int, tokenHash, tokenHint string, expiresAt time.Time) error
+	GetActiveLinks(listID int) ([]ShareLink, error)
+	RevokeLink(listID, linkID int) error
+	GetListIDByToken(tokenHash string) (int, error)
+}
+
+type shareLinkRepository struct {
+	db *sql.DB
+}
+
+func NewShareLinkRepository(db *sql.DB) ShareLinkRepository {
+	return &shareLinkRepository{db}
+}
+
+// Store a new link, a zero expiresAt means the link works until it is revoked
+func (r *shareLinkRepository) CreateLink(listID int, tokenHash, tokenHint string, expiresAt time.Time) error {
+	var expires sql.NullTime
+	if !expiresAt.IsZero() {
+		expires = sql.NullTime{Time: expiresAt.UTC(), Valid: true}
+	}
+
+	query := "INSERT INTO list_share_links (list_id, token_hash, token_hint, created_at, expires_at) VALUES (?, ?, ?, ?, ?)"
+	_, err := r.db.Exec(query, listID, tokenHash, tokenHint, time.Now().UTC(), expires)
+	return err
+}
+
+// Return the links of the list that are neither revoked nor expired
+func (r *shareLinkRepository) GetActiveLinks(listID int) ([]ShareLink, error) {
+	query := `SELECT id, token_hint, created_at, expires_at FROM list_share_links
+		WHERE list_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)
+		ORDER BY created_at`
+	rows, err := r.db.Query(query, listID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []ShareLink
+
+	for rows.Next() {
+		link := ShareLink{ListID: listID}
+		var expiresAt sql.NullTime
+
+		err := rows.Scan(&link.ID, &link.TokenHint, &link.CreatedAt, &expiresAt)
+		if err != nil {
+			return nil, err
+		}
+		link.ExpiresAt = expiresAt.Time
+
+		links = append(links, link)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+func (r *shareLinkRepository) RevokeLink(listID, linkID int) error {
+	query := "UPDATE list_share_links SET revoked_at = ? WHERE id = ? AND list_id = ? AND revoked_at IS NULL"
+	_, err := r.db.Exec(query, time.Now().UTC(), linkID, listID)
+	return err
+}
+
+// Return the list the token gives access to, or 0 if the token is unknown, revoked or expired
+func (r *shareLinkRepository) GetListIDByToken(tokenHash string) (int, error) {
+	query := `SELECT list_id FROM list_share_links
+		WHERE token_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)`
+	var listID int
+	err := r.db.QueryRow(query, tokenHash, time.Now().UTC()).Scan(&listID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return listID, nil
+}
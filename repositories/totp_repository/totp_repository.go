@@ -0,0 +1,142 @@
+package totp_repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type TOTP struct {
+	UserID       int
+	Secret       string
+	Enabled      bool
+	LastUsedStep int64
+}
+
+type TOTPRepository interface {
+	GetTOTP(userID int) (*TOTP, error)
+	IsEnabled(userID int) (bool, error)
+	SavePendingSecret(userID int, secret string) error
+	Enable(userID int, recoveryCodeHashes []string) error
+	Disable(userID int) error
+	UseStep(userID int, step int64) (bool, error)
+	UseRecoveryCode(userID int, codeHash string) (bool, error)
+}
+
+type totpRepository struct {
+	db *sql.DB
+}
+
+func NewTOTPRepository(db *sql.DB) TOTPRepository {
+	return &totpRepository{db}
+}
+
+// Return the two-factor settings of the user or nil if enrollment never started
+func (r *totpRepository) GetTOTP(userID int) (*TOTP, error) {
+	query := "SELECT user_id, secret, enabled_at IS NOT NULL, last_used_step FROM user_totp WHERE user_id = ?"
+	var t TOTP
+	err := r.db.QueryRow(query, userID).Scan(&t.UserID, &t.Secret, &t.Enabled, &t.LastUsedStep)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *totpRepository) IsEnabled(userID int) (bool, error) {
+	query := "SELECT COUNT(*) FROM user_totp WHERE user_id = ? AND enabled_at IS NOT NULL"
+	var count int
+	err := r.db.QueryRow(query, userID).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Store a secret that is not enabled until the user confirms a code generated from it
+func (r *totpRepository) SavePendingSecret(userID int, secret string) error {
+	query := `INSERT INTO user_totp (user_id, secret) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE secret = IF(enabled_at IS NULL, VALUES(secret), secret)`
+	_, err := r.db.Exec(query, userID, secret)
+	return err
+}
+
+// Enable two-factor authentication and replace the recovery codes in one transaction
+func (r *totpRepository) Enable(userID int, recoveryCodeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE user_totp SET enabled_at = ? WHERE user_id = ?", time.Now().UTC(), userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		_, err = tx.Exec("INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *totpRepository) Disable(userID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM user_totp WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Remember the time step of an accepted code, false means it was used already
+func (r *totpRepository) UseStep(userID int, step int64) (bool, error) {
+	query := "UPDATE user_totp SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?"
+	res, err := r.db.Exec(query, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// Mark a recovery code as used, false means it is unknown or was used already
+func (r *totpRepository) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	query := "UPDATE user_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL"
+	res, err := r.db.Exec(query, time.Now().UTC(), userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
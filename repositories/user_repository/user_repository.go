@@ -1,38 +1,164 @@
-package user_repository
-
-import (
-	"database/sql"
-)
-
-type UserRepository interface {
-	ValidateCredentials(email, password string) (string, error)
-	IsEmailExists(email string) (bool, error)
-}
-
-type userRepository struct {
-	db *sql.DB
-}
-
-func NewUserRepository(db *sql.DB) UserRepository {
-	return &userRepository{db}
-}
-
-func (r *userRepository) ValidateCredentials(email, password string) (string, error) {
-	query := "SELECT name FROM users WHERE email = ? AND password = ?"
-	var username string
-	err := r.db.QueryRow(query, email, password).Scan(&username)
-	if err != nil {
-		return "", err
-	}
-	return username, nil
-}
-
-func (r *userRepository) IsEmailExists(email string) (bool, error) {
-	query := "SELECT COUNT(*) FROM users WHERE email = ?"
-	var count int
-	err := r.db.QueryRow(query, email).Scan(&count)
-	if err != nil {
-		return false, err
-	}
-	return count > 0, nil
-}
+package user_repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Akhanrok/go_labs/services/password_service"
+)
+
+type User struct {
+	ID            int
+	Name          string
+	Email         string
+	EmailVerified bool
+	CreatedAt     time.Time
+}
+
+type UserRepository interface {
+	CreateUser(name, email, password string) (int, error)
+	ValidateCredentials(email, password string) (*User, error)
+	IsEmailExists(email string) (bool, error)
+	GetUserByEmail(email string) (*User, error)
+	GetUserByID(userID int) (*User, error)
+	UpdatePassword(userID int, password string) error
+	MarkEmailVerified(userID int, email string) (bool, error)
+}
+
+type userRepository struct {
+	db     *sql.DB
+	hasher password_service.Hasher
+}
+
+const userColumns = "id, name, email, email_verified_at IS NOT NULL, created_at"
+
+func NewUserRepository(db *sql.DB) UserRepository {
+	return &userRepository{db, password_service.Default()}
+}
+
+func NewUserRepositoryWithHasher(db *sql.DB, hasher password_service.Hasher) UserRepository {
+	return &userRepository{db, hasher}
+}
+
+// Insert a new unverified user and return its ID
+func (r *userRepository) CreateUser(name, email, password string) (int, error) {
+	hash, err := r.hasher.Hash(password)
+	if err != nil {
+		return 0, err
+	}
+
+	query := "INSERT INTO users (name, email, password, created_at) VALUES (?, ?, ?, ?)"
+	res, err := r.db.Exec(query, name, email, hash, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// Return the user when the credentials are valid and nil otherwise
+func (r *userRepository) ValidateCredentials(email, password string) (*User, error) {
+	query := "SELECT " + userColumns + ", password FROM users WHERE email = ?"
+	var user User
+	var encoded string
+	err := r.db.QueryRow(query, email).Scan(&user.ID, &user.Name, &user.Email, &user.EmailVerified, &user.CreatedAt, &encoded)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Spend the time of a real check, so the response time does not tell which emails are registered
+		dummy, err := password_service.DummyHash(r.hasher)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := r.hasher.Verify(dummy, password); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := r.hasher.Verify(encoded, password)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	// Replace plaintext passwords and outdated hashes now that the password is known
+	if r.hasher.NeedsRehash(encoded) {
+		if err := r.UpdatePassword(user.ID, password); err != nil {
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (r *userRepository) IsEmailExists(email string) (bool, error) {
+	query := "SELECT COUNT(*) FROM users WHERE email = ?"
+	var count int
+	err := r.db.QueryRow(query, email).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Return the user with the given email or nil if there is none
+func (r *userRepository) GetUserByEmail(email string) (*User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE email = ?"
+	return r.getUser(query, email)
+}
+
+// Return the user with the given ID or nil if there is none
+func (r *userRepository) GetUserByID(userID int) (*User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE id = ?"
+	return r.getUser(query, userID)
+}
+
+func (r *userRepository) UpdatePassword(userID int, password string) error {
+	hash, err := r.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	query := "UPDATE users SET password = ? WHERE id = ?"
+	_, err = r.db.Exec(query, hash, userID)
+	return err
+}
+
+// Mark the email as verified, the email has to match in case it changed after the link was sent
+func (r *userRepository) MarkEmailVerified(userID int, email string) (bool, error) {
+	query := "UPDATE users SET email_verified_at = ? WHERE id = ? AND email = ? AND email_verified_at IS NULL"
+	_, err := r.db.Exec(query, time.Now().UTC(), userID, email)
+	if err != nil {
+		return false, err
+	}
+
+	// Following the link twice is fine, so check the state instead of the affected rows
+	countQuery := "SELECT COUNT(*) FROM users WHERE id = ? AND email = ? AND email_verified_at IS NOT NULL"
+	var count int
+	err = r.db.QueryRow(countQuery, userID, email).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *userRepository) getUser(query string, args ...interface{}) (*User, error) {
+	var user User
+	err := r.db.QueryRow(query, args...).Scan(&user.ID, &user.Name, &user.Email, &user.EmailVerified, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
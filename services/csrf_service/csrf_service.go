@@ -0,0 +1,49 @@
+package csrf_service
+
+import (
+	"context"
+	"crypto/subtle"
+	"sync"
+)
+
+const (
+	// FieldName is the form field forms send the token in
+	FieldName = "csrf_token"
+	// HeaderName is the header scripts send the token in
+	HeaderName = "X-CSRF-Token"
+)
+
+type contextKey int
+
+const tokenContextKey contextKey = iota
+
+// A token that is only issued the first time a page asks for it
+type tokenSource struct {
+	once  sync.Once
+	issue func() (string, error)
+	token string
+	err   error
+}
+
+// Put a function in the context that issues the token of the request, it is called at most once
+func WithTokenSource(ctx context.Context, issue func() (string, error)) context.Context {
+	return context.WithValue(ctx, tokenContextKey, &tokenSource{issue: issue})
+}
+
+// Return the token of the request set up by the CSRF middleware, issuing it on first use
+func TokenFromContext(ctx context.Context) (string, error) {
+	source, ok := ctx.Value(tokenContextKey).(*tokenSource)
+	if !ok {
+		return "", nil
+	}
+
+	source.once.Do(func() {
+		source.token, source.err = source.issue()
+	})
+	return source.token, source.err
+}
+
+// Compare a submitted token with the expected one in constant time
+func ValidToken(expected, submitted string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(submitted)) == 1
+}
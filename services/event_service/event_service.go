@@ -0,0 +1,204 @@
+package event_service
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Event types sent to the browsers that have a list open
+const (
+	ProductAdded   = "product-added"
+	ProductUpdated = "product-updated"
+	ProductRemoved = "product-removed"
+	ListRenamed    = "list-renamed"
+	ListArchived   = "list-archived"
+	ListDeleted    = "list-deleted"
+	// Reset tells a client that events were lost and the page has to be reloaded
+	Reset = "reset"
+)
+
+// Event is a change of a list. IDs increase across all lists, so a client
+// following several lists resumes from a single Last-Event-ID.
+type Event struct {
+	ID     int64
+	ListID int
+	Type   string
+	Data   json.RawMessage
+}
+
+// Subscription receives the events of a set of lists until it is closed
+type Subscription struct {
+	// Replay holds the events missed since the Last-Event-ID of the client
+	Replay []Event
+	// Reset is set when missed events are no longer available
+	Reset  bool
+	Events <-chan Event
+	Close  func()
+}
+
+// Broker distributes list events between the open browsers. Hub keeps them in
+// process; an implementation backed by a shared broker lets several servers run.
+type Broker interface {
+	Publish(listID int, eventType string, data interface{}) error
+	Subscribe(listIDs []int, lastEventID int64) (*Subscription, error)
+}
+
+const (
+	// Events kept per list for clients that reconnect
+	replaySize = 100
+	// Events buffered per subscriber, slower subscribers are disconnected and replay on reconnect
+	subscriberBuffer = 32
+	// Lists nobody follows drop their events after this time
+	idleTimeout = time.Hour
+)
+
+type subscriber struct {
+	events  chan Event
+	listIDs []int
+	closed  bool
+}
+
+type channel struct {
+	events []Event
+	// Events up to this ID are no longer kept
+	evictedUpTo int64
+	lastEventAt time.Time
+	subscribers map[*subscriber]struct{}
+}
+
+// Hub is an in-process Broker
+type Hub struct {
+	mu       sync.Mutex
+	lastID   int64
+	channels map[int]*channel
+	// Events up to this ID may have been dropped with an idle list
+	prunedUpTo int64
+	prunedAt   time.Time
+}
+
+func NewHub() *Hub {
+	// Start the IDs at the current time, so IDs handed out before a restart are
+	// older than anything the new hub knows and the client is told to reset
+	startID := time.Now().UnixNano()
+	return &Hub{lastID: startID, prunedUpTo: startID, prunedAt: time.Now(), channels: map[int]*channel{}}
+}
+
+func (h *Hub) channel(listID int) *channel {
+	c, ok := h.channels[listID]
+	if !ok {
+		c = &channel{evictedUpTo: h.prunedUpTo, subscribers: map[*subscriber]struct{}{}}
+		h.channels[listID] = c
+	}
+	return c
+}
+
+// Drop the events of lists nobody followed for a while, must be called with the lock held
+func (h *Hub) pruneIdle(now time.Time) {
+	if now.Sub(h.prunedAt) < time.Minute {
+		return
+	}
+	h.prunedAt = now
+
+	for listID, c := range h.channels {
+		if len(c.subscribers) == 0 && now.Sub(c.lastEventAt) > idleTimeout {
+			if len(c.events) > 0 && c.events[len(c.events)-1].ID > h.prunedUpTo {
+				h.prunedUpTo = c.events[len(c.events)-1].ID
+			}
+			delete(h.channels, listID)
+		}
+	}
+}
+
+func (h *Hub) Publish(listID int, eventType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	h.pruneIdle(now)
+
+	h.lastID++
+	event := Event{ID: h.lastID, ListID: listID, Type: eventType, Data: payload}
+
+	c := h.channel(listID)
+	c.lastEventAt = now
+	c.events = append(c.events, event)
+	if len(c.events) > replaySize {
+		c.evictedUpTo = c.events[0].ID
+		c.events = c.events[1:]
+	}
+
+	for s := range c.subscribers {
+		select {
+		case s.events <- event:
+		default:
+			// The subscriber does not keep up, it will catch up through replay
+			h.unsubscribe(s)
+		}
+	}
+	return nil
+}
+
+func (h *Hub) Subscribe(listIDs []int, lastEventID int64) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := &subscriber{events: make(chan Event, subscriberBuffer), listIDs: listIDs}
+	sub := &Subscription{Events: s.events}
+
+	for _, listID := range listIDs {
+		c := h.channel(listID)
+		c.subscribers[s] = struct{}{}
+
+		if lastEventID == 0 {
+			continue
+		}
+		if lastEventID < c.evictedUpTo || lastEventID > h.lastID {
+			sub.Reset = true
+			continue
+		}
+		for _, event := range c.events {
+			if event.ID > lastEventID {
+				sub.Replay = append(sub.Replay, event)
+			}
+		}
+	}
+
+	// Events of several lists are replayed in the order they happened
+	sortEvents(sub.Replay)
+
+	sub.Close = func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.unsubscribe(s)
+	}
+	return sub, nil
+}
+
+// Remove the subscriber from every list, must be called with the lock held
+func (h *Hub) unsubscribe(s *subscriber) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+
+	for _, listID := range s.listIDs {
+		if c, ok := h.channels[listID]; ok {
+			delete(c.subscribers, s)
+		}
+	}
+	close(s.events)
+}
+
+func sortEvents(events []Event) {
+	for i := 1; i < len(events); i++ {
+		for j := i; j > 0 && events[j].ID < events[j-1].ID; j-- {
+			events[j], events[j-1] = events[j-1], events[j]
+		}
+	}
+}
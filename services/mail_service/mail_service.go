@@ -0,0 +1,142 @@
+package mail_service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Akhanrok/go_labs/config"
+)
+
+// ErrInvalidHeader is returned for a message whose header values contain line breaks
+var ErrInvalidHeader = errors.New("mail header contains a line break")
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails to users
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Create the mailer selected by the MAIL_DRIVER setting
+func NewMailer(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case "", "stdout":
+		return NewWriterMailer(os.Stdout, cfg.From), nil
+	case "file":
+		return NewFileMailer(cfg.FilePath, cfg.From), nil
+	case "smtp":
+		return NewSMTPMailer(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
+
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPMailer(cfg config.MailConfig) Mailer {
+	var auth smtp.Auth
+	if cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+	return &smtpMailer{
+		addr: net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort),
+		auth: auth,
+		from: cfg.From,
+	}
+}
+
+func (m *smtpMailer) Send(msg Message) error {
+	data, err := formatMessage(m.from, msg)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, data)
+}
+
+// writerMailer writes emails to a writer instead of sending them, for development and tests
+type writerMailer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+func NewWriterMailer(w io.Writer, from string) Mailer {
+	return &writerMailer{w: w, from: from}
+}
+
+func (m *writerMailer) Send(msg Message) error {
+	data, err := formatMessage(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err = fmt.Fprintf(m.w, "%s\r\n", data)
+	return err
+}
+
+// fileMailer appends emails to a file
+type fileMailer struct {
+	mu   sync.Mutex
+	path string
+	from string
+}
+
+func NewFileMailer(path, from string) Mailer {
+	return &fileMailer{path: path, from: from}
+}
+
+func (m *fileMailer) Send(msg Message) error {
+	data, err := formatMessage(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s\r\n", data)
+	return err
+}
+
+// Build the message, refusing header values that could add headers of their own
+func formatMessage(from string, msg Message) ([]byte, error) {
+	for _, value := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, ErrInvalidHeader
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", msg.Subject))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String()), nil
+}
@@ -0,0 +1,132 @@
+package merge_service
+
+import (
+	"strings"
+
+	"github.com/Akhanrok/go_labs/repositories/list_repository"
+	"github.com/Akhanrok/go_labs/repositories/product_repository"
+)
+
+// Resolution of a conflict that keeps the product once per store, the
+// resolutions choosing a store are the Key of one of the options
+const KeepSeparate = "separate"
+
+// A product found with different stores in the lists, the user picks the store
+// to buy all of it in or keeps one product per store
+type Conflict struct {
+	Key     string
+	Product string
+	Options []Option
+}
+
+// One of the stores of a conflicting product and the quantity wanted there
+type Option struct {
+	Key      string
+	Store    string
+	Quantity int
+}
+
+// The same product in the same store, gathered from all lists
+type group struct {
+	nameKey  string
+	storeKey string
+	product  product_repository.Product
+	// Quantity of the parts not purchased yet, the group is only purchased when every part is
+	pending int
+	total   int
+}
+
+// Merge combines the products of the lists. Products with the same name and store,
+// ignoring case and extra spaces, are added together. Only what is still to buy is
+// added up, unless everything was already purchased. Products with the same name in
+// different stores are returned as conflicts until resolutions has the store to use,
+// keyed by the Key of the conflict, or KeepSeparate.
+func Merge(lists []list_repository.ListData, resolutions map[string]string) ([]product_repository.Product, []Conflict) {
+	var groups []*group
+	byKey := map[string]*group{}
+	storesOf := map[string][]*group{}
+
+	for _, list := range lists {
+		for _, product := range list.Products {
+			nameKey, storeKey := Normalize(product.Product), Normalize(product.Store)
+
+			g, ok := byKey[nameKey+"\n"+storeKey]
+			if !ok {
+				g = &group{nameKey: nameKey, storeKey: storeKey, product: product_repository.Product{Product: product.Product, Store: product.Store}}
+				byKey[nameKey+"\n"+storeKey] = g
+				storesOf[nameKey] = append(storesOf[nameKey], g)
+				groups = append(groups, g)
+			}
+
+			g.total += product.Quantity
+			if !product.Purchased {
+				g.pending += product.Quantity
+			}
+		}
+	}
+
+	var products []product_repository.Product
+	var conflicts []Conflict
+	done := map[string]bool{}
+
+	for _, g := range groups {
+		stores := storesOf[g.nameKey]
+		if len(stores) == 1 || resolutions[g.nameKey] == KeepSeparate {
+			products = append(products, toProduct(g))
+			continue
+		}
+		if done[g.nameKey] {
+			continue
+		}
+		done[g.nameKey] = true
+
+		// All of the product is bought in the chosen store
+		var chosen *group
+		for _, s := range stores {
+			if optionKey(s) == resolutions[g.nameKey] {
+				chosen = s
+			}
+		}
+		if chosen == nil {
+			conflict := Conflict{Key: g.nameKey, Product: g.product.Product}
+			for _, s := range stores {
+				conflict.Options = append(conflict.Options, Option{Key: optionKey(s), Store: s.product.Store, Quantity: quantity(s)})
+			}
+			conflicts = append(conflicts, conflict)
+			continue
+		}
+
+		combined := &group{product: chosen.product}
+		for _, s := range stores {
+			combined.total += s.total
+			combined.pending += s.pending
+		}
+		products = append(products, toProduct(combined))
+	}
+
+	return products, conflicts
+}
+
+// Normalize makes names that only differ in case or spacing equal
+func Normalize(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+func quantity(g *group) int {
+	if g.pending == 0 {
+		return g.total
+	}
+	return g.pending
+}
+
+// Store names are prefixed so none of them can be taken for KeepSeparate
+func optionKey(g *group) string {
+	return "store:" + g.storeKey
+}
+
+func toProduct(g *group) product_repository.Product {
+	product := g.product
+	product.Quantity = quantity(g)
+	product.Purchased = g.pending == 0
+	return product
+}
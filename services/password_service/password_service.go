@@ -0,0 +1,231 @@
+package password_service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+var ErrInvalidHash = errors.New("invalid password hash")
+
+// Hasher hashes passwords and verifies them against stored values
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(encoded, password string) (bool, error)
+	NeedsRehash(encoded string) bool
+}
+
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  1,
+	Parallelism: 4,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+var defaultHasher Hasher = NewBcryptHasher(bcrypt.DefaultCost)
+
+// Set the hasher used by repositories that do not receive one explicitly
+func SetDefault(hasher Hasher) {
+	defaultHasher = hasher
+}
+
+func Default() Hasher {
+	return defaultHasher
+}
+
+// Hashes of a random password per hasher, made once with the hasher's parameters
+var dummyHashes sync.Map
+
+// Return a hash made with the current parameters of the hasher that no password matches.
+// Verifying against it for unknown accounts takes as long as for existing ones.
+func DummyHash(hasher Hasher) (string, error) {
+	if hash, ok := dummyHashes.Load(hasher); ok {
+		return hash.(string), nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	hash, err := hasher.Hash(base64.RawStdEncoding.EncodeToString(b))
+	if err != nil {
+		return "", err
+	}
+
+	actual, _ := dummyHashes.LoadOrStore(hasher, hash)
+	return actual.(string), nil
+}
+
+// Create a hasher by algorithm name, bcrypt is used when the name is empty
+func NewHasher(algorithm string) (Hasher, error) {
+	switch strings.ToLower(algorithm) {
+	case "", AlgorithmBcrypt:
+		return NewBcryptHasher(bcrypt.DefaultCost), nil
+	case AlgorithmArgon2id:
+		return NewArgon2idHasher(DefaultArgon2Params), nil
+	default:
+		return nil, fmt.Errorf("unknown password hashing algorithm %q", algorithm)
+	}
+}
+
+type bcryptHasher struct {
+	cost int
+}
+
+func NewBcryptHasher(cost int) Hasher {
+	return &bcryptHasher{cost}
+}
+
+func (h *bcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h *bcryptHasher) Verify(encoded, password string) (bool, error) {
+	return verify(encoded, password)
+}
+
+func (h *bcryptHasher) NeedsRehash(encoded string) bool {
+	if !isBcrypt(encoded) {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.cost
+}
+
+type argon2idHasher struct {
+	params Argon2Params
+}
+
+func NewArgon2idHasher(params Argon2Params) Hasher {
+	return &argon2idHasher{params}
+}
+
+func (h *argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.params.Memory,
+		h.params.Iterations,
+		h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *argon2idHasher) Verify(encoded, password string) (bool, error) {
+	return verify(encoded, password)
+}
+
+func (h *argon2idHasher) NeedsRehash(encoded string) bool {
+	if !isArgon2id(encoded) {
+		return true
+	}
+	params, _, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.Memory != h.params.Memory ||
+		params.Iterations != h.params.Iterations ||
+		params.Parallelism != h.params.Parallelism ||
+		uint32(len(key)) != h.params.KeyLength
+}
+
+// Check a password against a bcrypt hash, an argon2id hash or a legacy plaintext value
+func verify(encoded, password string) (bool, error) {
+	switch {
+	case isBcrypt(encoded):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	case isArgon2id(encoded):
+		params, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, err
+		}
+		otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, otherKey) == 1, nil
+	default:
+		// Rows created before hashing was introduced hold the raw password
+		return subtle.ConstantTimeCompare([]byte(encoded), []byte(password)) == 1, nil
+	}
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func isArgon2id(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func decodeArgon2id(encoded string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if version != argon2.Version {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
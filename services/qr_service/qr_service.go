@@ -0,0 +1,500 @@
+package qr_service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrTooLong is returned for text that does not fit in the largest QR code
+var ErrTooLong = errors.New("text is too long for a QR code")
+
+// Code is a QR code at error correction level M, holding its text in byte mode
+type Code struct {
+	// Size is the number of modules on each side
+	Size    int
+	modules [][]bool
+}
+
+// Error correction codewords per block and number of blocks of level M, indexed by version
+var (
+	eccCodewordsPerBlock = []int{-1,
+		10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26,
+		26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28}
+	eccBlocks = []int{-1,
+		1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16,
+		17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49}
+)
+
+const (
+	minVersion = 1
+	maxVersion = 40
+	// Format bits of level M
+	levelMBits = 0
+)
+
+// Encode the text in the smallest QR code it fits in
+func Encode(text string) (*Code, error) {
+	data := []byte(text)
+
+	version := minVersion
+	for ; version <= maxVersion; version++ {
+		if 4+countBits(version)+8*len(data) <= 8*dataCodewords(version) {
+			break
+		}
+	}
+	if version > maxVersion {
+		return nil, ErrTooLong
+	}
+
+	codewords := addErrorCorrection(version, encodeData(version, data))
+
+	c := newCode(version)
+	isFunction := c.drawFunctionPatterns(version)
+	c.drawCodewords(codewords, isFunction)
+
+	// Use the mask that leaves the fewest patterns confusing for scanners
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask, isFunction)
+		c.drawFormatBits(mask)
+		if penalty := c.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		// Masks are XOR, so applying one again removes it
+		c.applyMask(mask, isFunction)
+	}
+	c.applyMask(best, isFunction)
+	c.drawFormatBits(best)
+
+	return c, nil
+}
+
+// Whether the module in column x and row y is dark
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y][x]
+}
+
+// Render the code as an SVG image with the quiet zone of four modules around it
+func (c *Code) SVG() string {
+	const border = 4
+	size := c.Size + 2*border
+
+	var path strings.Builder
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				fmt.Fprintf(&path, "M%d,%dh1v1h-1z", x+border, y+border)
+			}
+		}
+	}
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="100%%" height="100%%" fill="#fff"/><path d="%s" fill="#000"/></svg>`, size, size, path.String())
+}
+
+func newCode(version int) *Code {
+	size := 4*version + 17
+	modules := make([][]bool, size)
+	for i := range modules {
+		modules[i] = make([]bool, size)
+	}
+	return &Code{Size: size, modules: modules}
+}
+
+// Bits of the character count in byte mode
+func countBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// Modules left for data and error correction once the function patterns are drawn
+func rawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+func dataCodewords(version int) int {
+	return rawDataModules(version)/8 - eccCodewordsPerBlock[version]*eccBlocks[version]
+}
+
+// Byte mode segment followed by the terminator and padding up to the capacity of the version
+func encodeData(version int, data []byte) []byte {
+	var bits bitBuffer
+	bits.append(0x4, 4)
+	bits.append(len(data), countBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+
+	capacity := 8 * dataCodewords(version)
+	terminator := capacity - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	result := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			result[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return result
+}
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*b = append(*b, (value>>i)&1 != 0)
+	}
+}
+
+// Split the data into blocks, add Reed-Solomon codewords to each and interleave them
+func addErrorCorrection(version int, data []byte) []byte {
+	numBlocks := eccBlocks[version]
+	eccLen := eccCodewordsPerBlock[version]
+	rawCodewords := rawDataModules(version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := reedSolomonDivisor(eccLen)
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := range blocks {
+		dataLen := shortBlockLen - eccLen
+		if i >= numShortBlocks {
+			dataLen++
+		}
+		block := append([]byte(nil), data[k:k+dataLen]...)
+		k += dataLen
+		ecc := reedSolomonRemainder(block, divisor)
+		if i < numShortBlocks {
+			// A placeholder keeps the blocks the same length, it is skipped below
+			block = append(block, 0)
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortBlockLen-eccLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// Generator polynomial of the given degree, without its leading term
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coefficient := range divisor {
+			result[i] ^= gfMultiply(coefficient, factor)
+		}
+	}
+	return result
+}
+
+// Multiply in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+// Draw the finder, timing and alignment patterns and the version, and reserve the format areas.
+// The returned grid marks the modules that data must not be placed in.
+func (c *Code) drawFunctionPatterns(version int) [][]bool {
+	isFunction := make([][]bool, c.Size)
+	for i := range isFunction {
+		isFunction[i] = make([]bool, c.Size)
+	}
+	set := func(x, y int, dark bool) {
+		c.modules[y][x] = dark
+		isFunction[y][x] = true
+	}
+
+	for i := 0; i < c.Size; i++ {
+		set(6, i, i%2 == 0)
+		set(i, 6, i%2 == 0)
+	}
+
+	for _, corner := range [][2]int{{3, 3}, {c.Size - 4, 3}, {3, c.Size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := corner[0]+dx, corner[1]+dy
+				if x >= 0 && x < c.Size && y >= 0 && y < c.Size {
+					dist := chebyshev(dx, dy)
+					set(x, y, dist != 2 && dist != 4)
+				}
+			}
+		}
+	}
+
+	positions := alignmentPositions(version, c.Size)
+	last := len(positions) - 1
+	for i, px := range positions {
+		for j, py := range positions {
+			// The corners with finder patterns have no alignment pattern
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					set(px+dx, py+dy, chebyshev(dx, dy) != 1)
+				}
+			}
+		}
+	}
+
+	// Reserve the format areas, the bits are drawn with the mask
+	for i := 0; i < 9; i++ {
+		isFunction[8][i] = true
+		isFunction[i][8] = true
+	}
+	for i := 0; i < 8; i++ {
+		isFunction[8][c.Size-1-i] = true
+		isFunction[c.Size-1-i][8] = true
+	}
+
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		bits := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := (bits>>i)&1 != 0
+			a, b := c.Size-11+i%3, i/3
+			set(a, b, dark)
+			set(b, a, dark)
+		}
+	}
+
+	return isFunction
+}
+
+func alignmentPositions(version, size int) []int {
+	if version == 1 {
+		return nil
+	}
+
+	numAlign := version/7 + 2
+	step := (version*8 + numAlign*3 + 5) / (numAlign*4 - 4) * 2
+	result := make([]int, numAlign)
+	result[0] = 6
+	for i, pos := numAlign-1, size-7; i >= 1; i, pos = i-1, pos-step {
+		result[i] = pos
+	}
+	return result
+}
+
+func (c *Code) drawFormatBits(mask int) {
+	data := levelMBits<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool {
+		return (bits>>i)&1 != 0
+	}
+
+	// Next to the top left finder pattern
+	for i := 0; i <= 5; i++ {
+		c.modules[i][8] = bit(i)
+	}
+	c.modules[7][8] = bit(6)
+	c.modules[8][8] = bit(7)
+	c.modules[8][7] = bit(8)
+	for i := 9; i < 15; i++ {
+		c.modules[8][14-i] = bit(i)
+	}
+
+	// Split between the other two finder patterns
+	for i := 0; i < 8; i++ {
+		c.modules[8][c.Size-1-i] = bit(i)
+	}
+	for i := 8; i < 15; i++ {
+		c.modules[c.Size-15+i][8] = bit(i)
+	}
+	c.modules[c.Size-8][8] = true
+}
+
+// Place the codewords in the zigzag of two module wide columns from the bottom right corner
+func (c *Code) drawCodewords(codewords []byte, isFunction [][]bool) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		// The vertical timing pattern takes a whole column
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if upward {
+				y = c.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if !isFunction[y][x] && i < len(codewords)*8 {
+					c.modules[y][x] = (codewords[i/8]>>(7-i%8))&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (c *Code) applyMask(mask int, isFunction [][]bool) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !isFunction[y][x] {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// Score the code by the rules of the specification, lower is easier to scan
+func (c *Code) penalty() int {
+	result := 0
+
+	// Runs of five or more modules of one color and patterns that look like finders
+	finderLike := []string{"10111010000", "00001011101"}
+	for _, line := range c.lines() {
+		run := 1
+		for i := 1; i <= len(line); i++ {
+			if i < len(line) && line[i] == line[i-1] {
+				run++
+				continue
+			}
+			if run >= 5 {
+				result += 3 + run - 5
+			}
+			run = 1
+		}
+		for _, pattern := range finderLike {
+			result += 40 * strings.Count(line, pattern)
+		}
+	}
+
+	// Blocks of two by two modules of one color
+	for y := 0; y < c.Size-1; y++ {
+		for x := 0; x < c.Size-1; x++ {
+			dark := c.modules[y][x]
+			if dark == c.modules[y][x+1] && dark == c.modules[y+1][x] && dark == c.modules[y+1][x+1] {
+				result += 3
+			}
+		}
+	}
+
+	// Balance of dark and light modules
+	dark := 0
+	for _, row := range c.modules {
+		for _, module := range row {
+			if module {
+				dark++
+			}
+		}
+	}
+	total := c.Size * c.Size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	result += 10 * k
+
+	return result
+}
+
+// Rows and columns of the code as strings of 0 and 1
+func (c *Code) lines() []string {
+	lines := make([]string, 0, 2*c.Size)
+	for y := 0; y < c.Size; y++ {
+		var row, column strings.Builder
+		for x := 0; x < c.Size; x++ {
+			row.WriteByte(moduleChar(c.modules[y][x]))
+			column.WriteByte(moduleChar(c.modules[x][y]))
+		}
+		lines = append(lines, row.String(), column.String())
+	}
+	return lines
+}
+
+func moduleChar(dark bool) byte {
+	if dark {
+		return '1'
+	}
+	return '0'
+}
+
+func chebyshev(dx, dy int) int {
+	if abs(dx) > abs(dy) {
+		return abs(dx)
+	}
+	return abs(dy)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
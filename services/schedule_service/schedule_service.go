@@ -0,0 +1,266 @@
+package schedule_service
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Akhanrok/go_labs/repositories/list_schedule_repository"
+)
+
+const (
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+	// LastDay as the day of a monthly rule means the last day of every month
+	LastDay = -1
+	// Generated lists are created at most this many periods apart
+	maxInterval = 52
+	// Room left in the VARCHAR(255) list names for the date and a number
+	maxSourceNameLength = 235
+)
+
+// Occurrences are days in this location, set once at startup
+var location = time.UTC
+
+func SetLocation(loc *time.Location) {
+	location = loc
+}
+
+func Location() *time.Location {
+	return location
+}
+
+// Two letter weekday codes of RRULE, in the order of time.Weekday
+var weekdayCodes = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// Rule is the subset of RFC 5545 RRULE used by recurring lists, like
+// "FREQ=WEEKLY;INTERVAL=1;BYDAY=SA" or "FREQ=MONTHLY;INTERVAL=1;BYMONTHDAY=1".
+// Occurrences are whole days, counted from the day the schedule starts.
+type Rule struct {
+	Frequency string
+	Interval  int
+	// Weekday of a weekly rule
+	Weekday time.Weekday
+	// Day of a monthly rule, 1 to 31 or LastDay. Days past the end of a short month fall on its last day.
+	MonthDay int
+}
+
+func ParseRule(value string) (Rule, error) {
+	rule := Rule{Interval: 1}
+	hasDay := false
+
+	for _, part := range strings.Split(value, ";") {
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return Rule{}, fmt.Errorf("invalid rule part %q", part)
+		}
+
+		switch key {
+		case "FREQ":
+			rule.Frequency = val
+		case "INTERVAL":
+			interval, err := strconv.Atoi(val)
+			if err != nil {
+				return Rule{}, fmt.Errorf("invalid interval %q", val)
+			}
+			rule.Interval = interval
+		case "BYDAY":
+			weekday, ok := parseWeekday(val)
+			if !ok {
+				return Rule{}, fmt.Errorf("invalid weekday %q", val)
+			}
+			rule.Weekday = weekday
+			hasDay = true
+		case "BYMONTHDAY":
+			day, err := strconv.Atoi(val)
+			if err != nil {
+				return Rule{}, fmt.Errorf("invalid month day %q", val)
+			}
+			rule.MonthDay = day
+			hasDay = true
+		default:
+			return Rule{}, fmt.Errorf("unsupported rule part %q", key)
+		}
+	}
+
+	if !hasDay {
+		return Rule{}, fmt.Errorf("the rule needs BYDAY or BYMONTHDAY")
+	}
+	return rule, rule.Validate()
+}
+
+func parseWeekday(code string) (time.Weekday, bool) {
+	for i, c := range weekdayCodes {
+		if c == code {
+			return time.Weekday(i), true
+		}
+	}
+	return 0, false
+}
+
+func (r Rule) Validate() error {
+	if r.Interval < 1 || r.Interval > maxInterval {
+		return fmt.Errorf("the interval should be from 1 to %d", maxInterval)
+	}
+
+	switch r.Frequency {
+	case Weekly:
+		if r.Weekday < time.Sunday || r.Weekday > time.Saturday {
+			return fmt.Errorf("invalid weekday")
+		}
+	case Monthly:
+		if r.MonthDay != LastDay && (r.MonthDay < 1 || r.MonthDay > 31) {
+			return fmt.Errorf("the day of the month should be from 1 to 31")
+		}
+	default:
+		return fmt.Errorf("the frequency should be %s or %s", Weekly, Monthly)
+	}
+	return nil
+}
+
+// String formats the rule as RRULE, the form stored in the database
+func (r Rule) String() string {
+	if r.Frequency == Weekly {
+		return fmt.Sprintf("FREQ=WEEKLY;INTERVAL=%d;BYDAY=%s", r.Interval, weekdayCodes[r.Weekday])
+	}
+	return fmt.Sprintf("FREQ=MONTHLY;INTERVAL=%d;BYMONTHDAY=%d", r.Interval, r.MonthDay)
+}
+
+// Describe the rule for people, like "every Saturday" or "every 2 months on the last day"
+func (r Rule) Describe() string {
+	if r.Frequency == Weekly {
+		if r.Interval == 1 {
+			return "every " + r.Weekday.String()
+		}
+		return fmt.Sprintf("every %d weeks on %s", r.Interval, r.Weekday)
+	}
+
+	day := "the last day"
+	if r.MonthDay != LastDay {
+		day = "day " + strconv.Itoa(r.MonthDay)
+	}
+	if r.Interval == 1 {
+		return "every month on " + day
+	}
+	return fmt.Sprintf("every %d months on %s", r.Interval, day)
+}
+
+// Next returns the first occurrence after the given time. Occurrences are midnight
+// in the location of start, the day the schedule starts on.
+func (r Rule) Next(start, after time.Time) time.Time {
+	loc := start.Location()
+	after = after.In(loc)
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+
+	if r.Frequency == Weekly {
+		// The first matching weekday on or after the start
+		first := start.AddDate(0, 0, (int(r.Weekday)-int(start.Weekday())+7)%7)
+		if first.After(after) {
+			return first
+		}
+
+		// Skip whole periods at once, then step over the remaining ones
+		days := int(after.Sub(first).Hours() / 24)
+		period := 7 * r.Interval
+		next := first.AddDate(0, 0, days/period*period)
+		for !next.After(after) {
+			next = next.AddDate(0, 0, period)
+		}
+		return next
+	}
+
+	months := (after.Year()-start.Year())*12 + int(after.Month()-start.Month())
+	if months < 0 {
+		months = 0
+	}
+	// Begin with the period of the current month, its occurrence may still be ahead
+	months = months / r.Interval * r.Interval
+	for {
+		next := r.monthOccurrence(start, months)
+		if next.After(after) && !next.Before(start) {
+			return next
+		}
+		months += r.Interval
+	}
+}
+
+// Upcoming returns the next count occurrences after the given time
+func (r Rule) Upcoming(start, after time.Time, count int) []time.Time {
+	var occurrences []time.Time
+	for i := 0; i < count; i++ {
+		after = r.Next(start, after)
+		occurrences = append(occurrences, after)
+	}
+	return occurrences
+}
+
+// The occurrence in the month that is the given number of months after the start
+func (r Rule) monthOccurrence(start time.Time, months int) time.Time {
+	month := time.Date(start.Year(), start.Month()+time.Month(months), 1, 0, 0, 0, 0, start.Location())
+	lastDay := month.AddDate(0, 1, -1).Day()
+
+	day := r.MonthDay
+	if day == LastDay || day > lastDay {
+		day = lastDay
+	}
+	return month.AddDate(0, 0, day-1)
+}
+
+// Name of the list generated for an occurrence
+func ListName(source string, occurrence time.Time) string {
+	if runes := []rune(source); len(runes) > maxSourceNameLength {
+		source = string(runes[:maxSourceNameLength])
+	}
+	return source + " " + occurrence.In(location).Format("2006-01-02")
+}
+
+// Start returns the day a schedule starts on as midnight in the schedule location.
+// The day is stored as a date, it means that day wherever the schedule runs.
+func Start(day time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, location)
+}
+
+// Generate the lists of every schedule that is due. A schedule missed for several
+// occurrences, for example while the server was down, generates one list and moves on
+// to the next occurrence in the future. The repository claims each occurrence in the
+// same transaction that creates the list, so running this again or from several
+// servers never generates a list twice.
+func RunDue(repo list_schedule_repository.ListScheduleRepository, now time.Time) {
+	schedules, err := repo.GetDueSchedules(now)
+	if err != nil {
+		log.Printf("failed to load due list schedules: %v", err)
+		return
+	}
+
+	for _, schedule := range schedules {
+		rule, err := ParseRule(schedule.Rule)
+		if err != nil {
+			log.Printf("invalid rule of list schedule %d: %v", schedule.ID, err)
+			continue
+		}
+
+		nextRunAt := rule.Next(Start(schedule.StartsOn), now).UTC()
+
+		listID, err := repo.Generate(schedule, ListName(schedule.ListName, schedule.NextRunAt), nextRunAt)
+		if err != nil {
+			log.Printf("failed to generate the list of schedule %d: %v", schedule.ID, err)
+			continue
+		}
+		if listID != 0 {
+			log.Printf("generated list %d from list %d", listID, schedule.ListID)
+		}
+	}
+}
+
+// Generate due lists right away and then every interval, until the process exits
+func Run(repo list_schedule_repository.ListScheduleRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	RunDue(repo, time.Now())
+	for range ticker.C {
+		RunDue(repo, time.Now())
+	}
+}
@@ -0,0 +1,135 @@
+package search_service
+
+import (
+	"html/template"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Akhanrok/go_labs/repositories/list_repository"
+)
+
+const (
+	// Longer queries are cut, their words are not searched
+	MaxQueryLength = 100
+	maxTerms       = 10
+)
+
+// Terms splits a query into lower case words of letters and digits, without duplicates.
+// Everything else, like quotes or the operators of FULLTEXT searches, separates words.
+func Terms(query string) []string {
+	if utf8.RuneCountInString(query) > MaxQueryLength {
+		query = string([]rune(query)[:MaxQueryLength])
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var terms []string
+	seen := map[string]bool{}
+	for _, word := range words {
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+		if len(terms) == maxTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// Score rates how well the text matches the terms: a whole word counts most,
+// the start of a word less and a match inside a word least
+func Score(text string, terms []string) int {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	score := 0
+	for _, term := range terms {
+		best := 0
+		for _, word := range words {
+			switch {
+			case word == term:
+				best = 3
+			case strings.HasPrefix(word, term) && best < 2:
+				best = 2
+			case strings.Contains(word, term) && best < 1:
+				best = 1
+			}
+		}
+		score += best
+	}
+	return score
+}
+
+// Rank orders search results by relevance. A match in the list name counts twice
+// as much as one in a product, lists with the same score are sorted by name.
+func Rank(lists []list_repository.ListData, terms []string) {
+	scores := make(map[int]int, len(lists))
+	for _, list := range lists {
+		score := 2 * Score(list.ListName, terms)
+		for _, product := range list.Products {
+			productScore := Score(product.Product, terms)
+			if storeScore := Score(product.Store, terms); storeScore > productScore {
+				productScore = storeScore
+			}
+			score += productScore
+		}
+		scores[list.ID] = score
+	}
+
+	sort.SliceStable(lists, func(i, j int) bool {
+		if scores[lists[i].ID] != scores[lists[j].ID] {
+			return scores[lists[i].ID] > scores[lists[j].ID]
+		}
+		return strings.ToLower(lists[i].ListName) < strings.ToLower(lists[j].ListName)
+	})
+}
+
+// Highlight escapes the text for HTML and wraps every case-insensitive match of a term in <mark>
+func Highlight(text string, terms []string) template.HTML {
+	var b strings.Builder
+	plainStart := 0
+
+	for i := 0; i < len(text); {
+		length := matchAt(text[i:], terms)
+		if length == 0 {
+			_, size := utf8.DecodeRuneInString(text[i:])
+			i += size
+			continue
+		}
+
+		b.WriteString(template.HTMLEscapeString(text[plainStart:i]))
+		b.WriteString("<mark>")
+		b.WriteString(template.HTMLEscapeString(text[i : i+length]))
+		b.WriteString("</mark>")
+		i += length
+		plainStart = i
+	}
+	b.WriteString(template.HTMLEscapeString(text[plainStart:]))
+
+	return template.HTML(b.String())
+}
+
+// Length in bytes of the longest term the text starts with, ignoring case, or 0
+func matchAt(text string, terms []string) int {
+	longest := 0
+	for _, term := range terms {
+		// Compare the same number of runes, lower and upper case may differ in bytes
+		end, count := 0, 0
+		for end < len(text) && count < utf8.RuneCountInString(term) {
+			_, size := utf8.DecodeRuneInString(text[end:])
+			end += size
+			count++
+		}
+		if count == utf8.RuneCountInString(term) && strings.EqualFold(text[:end], term) && end > longest {
+			longest = end
+		}
+	}
+	return longest
+}
@@ -1,30 +1,73 @@
-package services
-
-import (
-	"fmt"
-	"net/http"
-	"regexp"
-	"text/template"
-)
-
-func RenderTemplate(w http.ResponseWriter, tmpl string, data interface{}) {
-	tmpl = fmt.Sprintf("templates/%s", tmpl)
-	t, err := template.ParseFiles(tmpl)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	err = t.Execute(w, data)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-}
-
-func IsValidEmail(email string) bool {
-	// Email validation regex pattern
-	pattern := `^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`
-	match, _ := regexp.MatchString(pattern, email)
-	return match
-}
+package services
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"regexp"
+
+	"github.com/Akhanrok/go_labs/services/csrf_service"
+	"github.com/Akhanrok/go_labs/services/search_service"
+	"github.com/Akhanrok/go_labs/services/session_service"
+	"github.com/Akhanrok/go_labs/services/template_service"
+)
+
+var renderer *template_service.Renderer
+
+// Parse the templates and fingerprint the static files found in fsys
+func NewRenderer(fsys fs.FS, dev bool) (*template_service.Renderer, error) {
+	// Only the names of the functions matter while parsing
+	return template_service.New(fsys, templateFuncs(nil), dev)
+}
+
+// Set the renderer used by RenderTemplate, called once at startup
+func SetRenderer(r *template_service.Renderer) {
+	renderer = r
+}
+
+// Render a page inside the shared layout. Pages define the "title", "content"
+// and optionally "head" templates, the partials provide the header, nav and flash area.
+func RenderTemplate(w http.ResponseWriter, r *http.Request, tmpl string, data interface{}) {
+	if renderer == nil {
+		http.Error(w, "templates are not loaded", http.StatusInternalServerError)
+		return
+	}
+
+	err := renderer.Render(w, tmpl, data, templateFuncs(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Functions available to every template
+func templateFuncs(r *http.Request) template.FuncMap {
+	return template.FuncMap{
+		"csrfToken": func() (string, error) {
+			return csrf_service.TokenFromContext(r.Context())
+		},
+		"csrfField": func() (template.HTML, error) {
+			token, err := csrf_service.TokenFromContext(r.Context())
+			if err != nil {
+				return "", err
+			}
+			return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`,
+				csrf_service.FieldName, template.HTMLEscapeString(token))), nil
+		},
+		"currentUser": func() *session_service.SessionUser {
+			user, _ := session_service.UserFromContext(r.Context())
+			return user
+		},
+		"flashes": func() []session_service.Flash {
+			return session_service.FlashesFromContext(r.Context())
+		},
+		"highlight": search_service.Highlight,
+	}
+}
+
+func IsValidEmail(email string) bool {
+	// Email validation regex pattern
+	pattern := `^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`
+	match, _ := regexp.MatchString(pattern, email)
+	return match
+}
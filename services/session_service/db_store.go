@@ -0,0 +1,252 @@
+package session_service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/gob"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Akhanrok/go_labs/config"
+	"github.com/Akhanrok/go_labs/repositories/session_repository"
+	"github.com/Akhanrok/go_labs/services/request_service"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// Only refresh the last seen time of a session once per interval to save writes
+const touchInterval = time.Minute
+
+// DBStore keeps session values in the sessions table and only a signed session ID in the cookie
+type DBStore struct {
+	Codecs  []securecookie.Codec
+	Options *sessions.Options
+	name    string
+	repo    session_repository.SessionRepository
+}
+
+// Create a database session store, the configured key pairs sign and encrypt the session ID cookie
+func NewDBStore(db *sql.DB, cfg config.SessionConfig) *DBStore {
+	codecs := securecookie.CodecsFromPairs(cfg.KeyPairs...)
+	for _, codec := range codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(cfg.MaxAge)
+		}
+	}
+
+	return &DBStore{
+		Codecs: codecs,
+		Options: &sessions.Options{
+			Path:     "/",
+			MaxAge:   cfg.MaxAge,
+			Secure:   cfg.Secure,
+			HttpOnly: cfg.HttpOnly,
+			SameSite: cfg.SameSite,
+		},
+		name: cfg.CookieName,
+		repo: session_repository.NewSessionRepository(db),
+	}
+}
+
+// Name of the session cookie
+func (s *DBStore) CookieName() string {
+	return s.name
+}
+
+func (s *DBStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+func (s *DBStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	var id string
+	err = securecookie.DecodeMulti(name, cookie.Value, &id, s.Codecs...)
+	if err != nil {
+		return session, err
+	}
+
+	row, err := s.repo.GetSession(id)
+	if err != nil || row == nil {
+		// Revoked and expired sessions start over as anonymous ones
+		return session, err
+	}
+
+	err = gob.NewDecoder(bytes.NewReader(row.Data)).Decode(&session.Values)
+	if err != nil {
+		return session, err
+	}
+
+	session.ID = row.ID
+	session.IsNew = false
+
+	now := time.Now().UTC()
+	if now.Sub(row.LastSeenAt) > touchInterval {
+		if err := s.repo.TouchSession(row.ID, now); err != nil {
+			return session, err
+		}
+	}
+
+	return session, nil
+}
+
+func (s *DBStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	// A negative MaxAge deletes the session
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.repo.DeleteSession(session.ID); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		id, err := generateSessionID()
+		if err != nil {
+			return err
+		}
+		session.ID = id
+	}
+
+	row, err := sessionRow(r, session)
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.SaveSession(row)
+	if err != nil {
+		return err
+	}
+
+	return s.setCookie(w, session)
+}
+
+// Save the session under a new ID and delete the row of the old one in the same step,
+// so an ID known before the session changed hands cannot be used afterwards
+func (s *DBStore) Rotate(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	oldID := session.ID
+	if oldID == "" {
+		return s.Save(r, w, session)
+	}
+
+	id, err := generateSessionID()
+	if err != nil {
+		return err
+	}
+	session.ID = id
+
+	row, err := sessionRow(r, session)
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.ReplaceSession(oldID, row)
+	if err != nil {
+		return err
+	}
+
+	return s.setCookie(w, session)
+}
+
+func (s *DBStore) setCookie(w http.ResponseWriter, session *sessions.Session) error {
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+func sessionRow(r *http.Request, session *sessions.Session) (session_repository.Session, error) {
+	var data bytes.Buffer
+	err := gob.NewEncoder(&data).Encode(session.Values)
+	if err != nil {
+		return session_repository.Session{}, err
+	}
+
+	var userID int
+	if user, ok := session.Values[userKey].(SessionUser); ok {
+		userID = user.ID
+	}
+
+	now := time.Now().UTC()
+	return session_repository.Session{
+		ID:         session.ID,
+		UserID:     userID,
+		Data:       data.Bytes(),
+		UserAgent:  truncate(r.UserAgent(), 255),
+		IP:         request_service.ClientIP(r),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(sessionLifetime(session.Options.MaxAge)),
+	}, nil
+}
+
+// Return the active sessions of the user
+func (s *DBStore) UserSessions(userID int) ([]session_repository.Session, error) {
+	return s.repo.GetUserSessions(userID)
+}
+
+// Revoke one session of the user
+func (s *DBStore) RevokeSession(userID int, id string) error {
+	return s.repo.DeleteUserSession(userID, id)
+}
+
+// Revoke every session of the user except the one with the given ID
+func (s *DBStore) RevokeOtherSessions(userID int, keepID string) error {
+	return s.repo.DeleteOtherUserSessions(userID, keepID)
+}
+
+// Periodically delete expired sessions, meant to be run in its own goroutine
+func (s *DBStore) CleanupExpired(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deleted, err := s.repo.DeleteExpiredSessions()
+		if err != nil {
+			log.Printf("failed to delete expired sessions: %v", err)
+			continue
+		}
+		if deleted > 0 {
+			log.Printf("deleted %d expired sessions", deleted)
+		}
+	}
+}
+
+func generateSessionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Sessions that only live as long as the browser is open are kept for a day
+func sessionLifetime(maxAge int) time.Duration {
+	if maxAge == 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(maxAge) * time.Second
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,233 @@
+package session_service
+
+import (
+	"context"
+	"encoding/gob"
+	"net/http"
+	"time"
+
+	"github.com/Akhanrok/go_labs/services/token_service"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	userKey             = "user"
+	pendingTwoFactorKey = "pending_2fa"
+	csrfTokenKey        = "csrf_token"
+)
+
+// How long the second login step may take after the password was accepted
+const pendingTwoFactorTTL = 5 * time.Minute
+
+// DefaultSessionName is the name of the session cookie of stores that do not name it themselves
+const DefaultSessionName = "session-name"
+
+// Stores that know the name of their cookie, like DBStore
+type namedStore interface {
+	CookieName() string
+}
+
+// Stores that keep sessions under an ID, like DBStore, replace the ID when the user logs in
+type rotatingStore interface {
+	Rotate(r *http.Request, w http.ResponseWriter, session *sessions.Session) error
+}
+
+// SessionUser is the identity of the authenticated user kept in the session
+type SessionUser struct {
+	ID   int
+	Name string
+}
+
+// PendingTwoFactor is a user who entered the right password but has not passed the second step yet
+type PendingTwoFactor struct {
+	UserID    int
+	Name      string
+	Email     string
+	Next      string
+	ExpiresAt time.Time
+}
+
+// Flash is a one-time message shown on the next rendered page
+type Flash struct {
+	Kind    string
+	Message string
+}
+
+const (
+	FlashInfo  = "info"
+	FlashError = "error"
+)
+
+type contextKey int
+
+const (
+	userContextKey contextKey = iota
+	flashesContextKey
+)
+
+func init() {
+	// Session values are gob encoded, so custom types have to be registered
+	gob.Register(SessionUser{})
+	gob.Register(PendingTwoFactor{})
+	gob.Register(Flash{})
+}
+
+func getSession(r *http.Request, store sessions.Store) (*sessions.Session, error) {
+	name := DefaultSessionName
+	if named, ok := store.(namedStore); ok {
+		name = named.CookieName()
+	}
+	return store.Get(r, name)
+}
+
+// Store the authenticated user in the session
+func SetUser(w http.ResponseWriter, r *http.Request, store sessions.Store, user SessionUser) error {
+	session, err := getSession(r, store)
+	if err != nil {
+		return err
+	}
+
+	session.Values[userKey] = user
+	delete(session.Values, pendingTwoFactorKey)
+
+	// Issue a new session ID on login so an ID planted before authentication is useless
+	if rotator, ok := store.(rotatingStore); ok {
+		return rotator.Rotate(r, w, session)
+	}
+	session.ID = ""
+	return session.Save(r, w)
+}
+
+// Remember a user waiting for the second login step
+func SetPendingTwoFactor(w http.ResponseWriter, r *http.Request, store sessions.Store, pending PendingTwoFactor) error {
+	session, err := getSession(r, store)
+	if err != nil {
+		return err
+	}
+
+	pending.ExpiresAt = time.Now().Add(pendingTwoFactorTTL)
+	session.Values[pendingTwoFactorKey] = pending
+	return session.Save(r, w)
+}
+
+// Return the user waiting for the second login step or nil if there is none or it took too long
+func GetPendingTwoFactor(r *http.Request, store sessions.Store) (*PendingTwoFactor, error) {
+	session, err := getSession(r, store)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, ok := session.Values[pendingTwoFactorKey].(PendingTwoFactor)
+	if !ok || time.Now().After(pending.ExpiresAt) {
+		return nil, nil
+	}
+	return &pending, nil
+}
+
+// Delete the session, logging the user out
+func Destroy(w http.ResponseWriter, r *http.Request, store sessions.Store) error {
+	session, err := getSession(r, store)
+	if err != nil {
+		return err
+	}
+
+	session.Values = make(map[interface{}]interface{})
+	session.Options.MaxAge = -1
+	return session.Save(r, w)
+}
+
+// Return the ID of the current session, empty for sessions that were never saved
+func CurrentSessionID(r *http.Request, store sessions.Store) (string, error) {
+	session, err := getSession(r, store)
+	if err != nil {
+		return "", err
+	}
+	return session.ID, nil
+}
+
+// Return the user stored in the session or nil for anonymous requests
+func GetUser(r *http.Request, store sessions.Store) (*SessionUser, error) {
+	session, err := getSession(r, store)
+	if err != nil {
+		return nil, err
+	}
+
+	user, ok := session.Values[userKey].(SessionUser)
+	if !ok {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+// Return the anti-forgery token of the session, creating one when the session has none yet
+func CSRFToken(w http.ResponseWriter, r *http.Request, store sessions.Store, create bool) (string, error) {
+	session, err := getSession(r, store)
+	if err != nil && session == nil {
+		return "", err
+	}
+
+	token, _ := session.Values[csrfTokenKey].(string)
+	if token != "" || !create {
+		return token, nil
+	}
+
+	token, err = token_service.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	session.Values[csrfTokenKey] = token
+	return token, session.Save(r, w)
+}
+
+// Queue a message for the next page the user sees, usually before a redirect
+func AddFlash(w http.ResponseWriter, r *http.Request, store sessions.Store, kind, message string) error {
+	session, err := getSession(r, store)
+	if err != nil {
+		return err
+	}
+
+	session.AddFlash(Flash{Kind: kind, Message: message})
+	return session.Save(r, w)
+}
+
+// Remove the queued messages from the session and return them
+func PopFlashes(w http.ResponseWriter, r *http.Request, store sessions.Store) ([]Flash, error) {
+	session, err := getSession(r, store)
+	if err != nil {
+		return nil, err
+	}
+
+	values := session.Flashes()
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	var flashes []Flash
+	for _, value := range values {
+		if flash, ok := value.(Flash); ok {
+			flashes = append(flashes, flash)
+		}
+	}
+	return flashes, session.Save(r, w)
+}
+
+func WithFlashes(ctx context.Context, flashes []Flash) context.Context {
+	return context.WithValue(ctx, flashesContextKey, flashes)
+}
+
+// Return the messages put in the request context by the flash middleware
+func FlashesFromContext(ctx context.Context) []Flash {
+	flashes, _ := ctx.Value(flashesContextKey).([]Flash)
+	return flashes
+}
+
+func WithUser(ctx context.Context, user *SessionUser) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// Return the user put in the request context by the auth middleware
+func UserFromContext(ctx context.Context) (*SessionUser, bool) {
+	user, ok := ctx.Value(userContextKey).(*SessionUser)
+	return user, ok && user != nil
+}
@@ -0,0 +1,91 @@
+package shopping_service
+
+import (
+	"sort"
+
+	"github.com/Akhanrok/go_labs/repositories/list_member_repository"
+	"github.com/Akhanrok/go_labs/repositories/list_repository"
+	"github.com/Akhanrok/go_labs/services/merge_service"
+)
+
+// A product of one list that makes up an item of the store view
+type Source struct {
+	ListID    int
+	ListName  string
+	ProductID int
+	Quantity  int
+}
+
+// Identical products of several lists added together
+type Item struct {
+	Product  string
+	Quantity int
+	Sources  []Source
+}
+
+// The items still to buy in one store
+type Store struct {
+	Name  string
+	Items []Item
+}
+
+// ByStore gathers the products not purchased yet from the active lists the user can edit,
+// grouped by store. Names are compared with merge_service.Normalize so the view adds up
+// the same products a merge would, the first spelling is shown. Stores and their items
+// are sorted by name.
+func ByStore(lists []list_repository.ListData) []Store {
+	var stores []Store
+	storeIndex := map[string]int{}
+	itemIndex := map[string]map[string]int{}
+
+	for _, list := range lists {
+		// Viewers can't check products off, archived lists are done
+		if list.Archived || !list.HasRole(list_member_repository.RoleEditor) {
+			continue
+		}
+
+		for _, product := range list.Products {
+			if product.Purchased {
+				continue
+			}
+
+			storeKey := merge_service.Normalize(product.Store)
+			s, ok := storeIndex[storeKey]
+			if !ok {
+				s = len(stores)
+				storeIndex[storeKey] = s
+				itemIndex[storeKey] = map[string]int{}
+				stores = append(stores, Store{Name: product.Store})
+			}
+
+			productKey := merge_service.Normalize(product.Product)
+			i, ok := itemIndex[storeKey][productKey]
+			if !ok {
+				i = len(stores[s].Items)
+				itemIndex[storeKey][productKey] = i
+				stores[s].Items = append(stores[s].Items, Item{Product: product.Product})
+			}
+
+			item := &stores[s].Items[i]
+			item.Quantity += product.Quantity
+			item.Sources = append(item.Sources, Source{
+				ListID:    list.ID,
+				ListName:  list.ListName,
+				ProductID: product.ID,
+				Quantity:  product.Quantity,
+			})
+		}
+	}
+
+	sort.SliceStable(stores, func(i, j int) bool {
+		return merge_service.Normalize(stores[i].Name) < merge_service.Normalize(stores[j].Name)
+	})
+	for _, store := range stores {
+		items := store.Items
+		sort.SliceStable(items, func(i, j int) bool {
+			return merge_service.Normalize(items[i].Product) < merge_service.Normalize(items[j].Product)
+		})
+	}
+
+	return stores
+}
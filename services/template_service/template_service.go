@@ -0,0 +1,244 @@
+package template_service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TemplatesDir = "templates"
+	StaticDir    = "static"
+
+	// Pages define "title" and "content" and are rendered through this template
+	layoutName = "layout.html"
+)
+
+// Renderer holds the page templates parsed once from fsys together with the
+// fingerprinted names of the static files. In dev mode both are reloaded when
+// a file changes on disk.
+type Renderer struct {
+	fsys  fs.FS
+	funcs template.FuncMap
+	dev   bool
+
+	mu       sync.RWMutex
+	pages    map[string]*template.Template
+	hashed   map[string]string // static name -> fingerprinted name
+	original map[string]string // fingerprinted name -> static name
+	loadedAt time.Time
+}
+
+// Parse every page in fsys. funcs must contain every function the templates use,
+// the values are replaced on each render.
+func New(fsys fs.FS, funcs template.FuncMap, dev bool) (*Renderer, error) {
+	renderer := &Renderer{fsys: fsys, funcs: funcs, dev: dev}
+
+	err := renderer.load()
+	if err != nil {
+		return nil, err
+	}
+	return renderer, nil
+}
+
+func (r *Renderer) load() error {
+	hashed, original, err := fingerprintStatic(r.fsys)
+	if err != nil {
+		return err
+	}
+
+	funcs := template.FuncMap{}
+	for name, fn := range r.funcs {
+		funcs[name] = fn
+	}
+	funcs["static"] = func(name string) string {
+		return staticURL(hashed, name)
+	}
+
+	names, err := fs.Glob(r.fsys, TemplatesDir+"/*.html")
+	if err != nil {
+		return err
+	}
+
+	pages := map[string]*template.Template{}
+	for _, name := range names {
+		page := path.Base(name)
+		if page == layoutName {
+			continue
+		}
+
+		t, err := template.New(layoutName).Funcs(funcs).ParseFS(r.fsys,
+			TemplatesDir+"/"+layoutName, TemplatesDir+"/partials/*.html", name)
+		if err != nil {
+			return fmt.Errorf("template %s: %w", page, err)
+		}
+		pages[page] = t
+	}
+
+	r.mu.Lock()
+	r.pages = pages
+	r.hashed = hashed
+	r.original = original
+	r.loadedAt = time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+// Reload the templates in dev mode when a file was modified after the last load
+func (r *Renderer) reloadIfChanged() error {
+	r.mu.RLock()
+	loadedAt := r.loadedAt
+	r.mu.RUnlock()
+
+	changed := false
+	for _, dir := range []string{TemplatesDir, StaticDir} {
+		err := fs.WalkDir(r.fsys, dir, func(name string, d fs.DirEntry, err error) error {
+			if name == dir && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil || d.IsDir() {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if info.ModTime().After(loadedAt) {
+				changed = true
+				return fs.SkipAll
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return r.load()
+}
+
+// Execute the page inside the layout. funcs provides the request specific values
+// of the template functions.
+func (r *Renderer) Render(w io.Writer, name string, data interface{}, funcs template.FuncMap) error {
+	if r.dev {
+		err := r.reloadIfChanged()
+		if err != nil {
+			return err
+		}
+	}
+
+	r.mu.RLock()
+	page, ok := r.pages[name]
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("template %s not found", name)
+	}
+
+	// The parsed page is shared between requests, so bind the functions on a copy
+	t, err := page.Clone()
+	if err != nil {
+		return err
+	}
+	t.Funcs(funcs)
+
+	// Render into a buffer so a failing template does not leave a half-written page
+	var buf bytes.Buffer
+	err = t.ExecuteTemplate(&buf, "layout", data)
+	if err != nil {
+		return err
+	}
+
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// Return the URL of a static file with its content hash in the name
+func (r *Renderer) StaticURL(name string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return staticURL(r.hashed, name)
+}
+
+// Serve the static files. Fingerprinted names never change their content and can be
+// cached for a year, plain names must be revalidated.
+func (r *Renderer) StaticHandler() http.Handler {
+	files, err := fs.Sub(r.fsys, StaticDir)
+	if err != nil {
+		// fs.Sub only fails for invalid directory names
+		panic(err)
+	}
+	fileServer := http.FileServer(http.FS(files))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name := strings.TrimPrefix(req.URL.Path, "/")
+
+		r.mu.RLock()
+		original, ok := r.original[name]
+		r.mu.RUnlock()
+
+		if ok && !r.dev {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		if ok {
+			req.URL.Path = "/" + original
+		}
+
+		fileServer.ServeHTTP(w, req)
+	})
+}
+
+func staticURL(hashed map[string]string, name string) string {
+	if fingerprinted, ok := hashed[name]; ok {
+		return "/" + StaticDir + "/" + fingerprinted
+	}
+	return "/" + StaticDir + "/" + name
+}
+
+// Compute the fingerprinted name of every static file, e.g. styles.css -> styles.1a2b3c4d5e.css
+func fingerprintStatic(fsys fs.FS) (map[string]string, map[string]string, error) {
+	hashed := map[string]string{}
+	original := map[string]string{}
+
+	err := fs.WalkDir(fsys, StaticDir, func(name string, d fs.DirEntry, err error) error {
+		// A site without static files is fine
+		if name == StaticDir && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(content)
+
+		relative := strings.TrimPrefix(name, StaticDir+"/")
+		ext := path.Ext(relative)
+		fingerprinted := strings.TrimSuffix(relative, ext) + "." + hex.EncodeToString(sum[:5]) + ext
+
+		hashed[relative] = fingerprinted
+		original[fingerprinted] = relative
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return hashed, original, nil
+}
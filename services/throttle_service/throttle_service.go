@@ -0,0 +1,253 @@
+package throttle_service
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Clock returns the current time, tests replace it to control time
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+var SystemClock Clock = systemClock{}
+
+type Config struct {
+	// Failures allowed per account and per client address before backoff starts
+	AccountFreeAttempts int
+	IPFreeAttempts      int
+	// Delay after the first failure past the free attempts, doubled with every next one
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Failures after which the next attempt locks the account, zero never locks it
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// Failures older than this are forgotten
+	Window time.Duration
+}
+
+var DefaultConfig = Config{
+	AccountFreeAttempts: 3,
+	IPFreeAttempts:      10,
+	BaseDelay:           time.Second,
+	MaxDelay:            5 * time.Minute,
+	LockoutThreshold:    10,
+	LockoutDuration:     15 * time.Minute,
+	Window:              time.Hour,
+}
+
+// ResendConfig limits how often verification emails can be requested for one email and from one address
+var ResendConfig = Config{
+	AccountFreeAttempts: 3,
+	IPFreeAttempts:      10,
+	BaseDelay:           time.Minute,
+	MaxDelay:            time.Hour,
+	Window:              24 * time.Hour,
+}
+
+// Entry holds the failed attempts recorded for one key
+type Entry struct {
+	Failures     int
+	LastFailure  time.Time
+	BlockedUntil time.Time
+	LockedUntil  time.Time
+}
+
+// Store keeps throttling entries, in memory or in a shared database
+type Store interface {
+	Get(key string) (Entry, bool)
+	Set(key string, entry Entry)
+	Delete(key string)
+}
+
+// Decision tells whether a login attempt may go ahead
+type Decision struct {
+	Allowed     bool
+	Locked      bool
+	LockedUntil time.Time
+	RetryAfter  time.Duration
+}
+
+type Throttler struct {
+	cfg   Config
+	store Store
+	clock Clock
+	mu    sync.Mutex
+}
+
+func NewThrottler(cfg Config, store Store, clock Clock) *Throttler {
+	return &Throttler{cfg: cfg, store: store, clock: clock}
+}
+
+// Check whether a login for the email from the client address may be attempted now.
+// An allowed attempt is counted as a failure right away, so guesses sent in parallel
+// are throttled while the first ones are still being checked. RecordSuccess or Refund
+// give the attempt back.
+func (t *Throttler) Check(email, ip string) Decision {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.clock.Now()
+
+	key := accountKey(email)
+	account := t.entry(key, now)
+	if t.cfg.LockoutThreshold > 0 && account.Failures >= t.cfg.LockoutThreshold {
+		account.LockedUntil = now.Add(t.cfg.LockoutDuration)
+		account.Failures = 0
+		t.store.Set(key, account)
+	}
+	if now.Before(account.LockedUntil) {
+		return Decision{Locked: true, LockedUntil: account.LockedUntil, RetryAfter: account.LockedUntil.Sub(now)}
+	}
+
+	address := t.entry(ipKey(ip), now)
+
+	retryAfter := time.Duration(0)
+	for _, entry := range []Entry{account, address} {
+		if wait := entry.BlockedUntil.Sub(now); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+	if retryAfter > 0 {
+		return Decision{RetryAfter: retryAfter}
+	}
+
+	t.store.Set(key, t.failure(account, t.cfg.AccountFreeAttempts, now))
+	t.store.Set(ipKey(ip), t.failure(address, t.cfg.IPFreeAttempts, now))
+
+	return Decision{Allowed: true}
+}
+
+// Give back an attempt that turned out not to be a wrong guess, such as a correct
+// password that still needs the second factor
+func (t *Throttler) Refund(email, ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.clock.Now()
+
+	key := accountKey(email)
+	t.store.Set(key, t.refund(t.entry(key, now), t.cfg.AccountFreeAttempts))
+
+	key = ipKey(ip)
+	t.store.Set(key, t.refund(t.entry(key, now), t.cfg.IPFreeAttempts))
+}
+
+// Forget the failures of the account after a successful login. The client address
+// only gets this attempt back, otherwise one valid account would reset guessing on others.
+func (t *Throttler) RecordSuccess(email, ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.store.Delete(accountKey(email))
+
+	key := ipKey(ip)
+	t.store.Set(key, t.refund(t.entry(key, t.clock.Now()), t.cfg.IPFreeAttempts))
+}
+
+func (t *Throttler) entry(key string, now time.Time) Entry {
+	entry, ok := t.store.Get(key)
+	if !ok {
+		return Entry{}
+	}
+
+	// Forget old failures unless the account is still locked
+	if now.Sub(entry.LastFailure) > t.cfg.Window && !now.Before(entry.LockedUntil) {
+		return Entry{}
+	}
+	return entry
+}
+
+func (t *Throttler) failure(entry Entry, freeAttempts int, now time.Time) Entry {
+	entry.Failures++
+	entry.LastFailure = now
+
+	if over := entry.Failures - freeAttempts; over > 0 {
+		delay := t.cfg.BaseDelay
+		for i := 1; i < over && delay < t.cfg.MaxDelay; i++ {
+			delay *= 2
+		}
+		if delay > t.cfg.MaxDelay {
+			delay = t.cfg.MaxDelay
+		}
+		entry.BlockedUntil = now.Add(delay)
+	}
+
+	return entry
+}
+
+func (t *Throttler) refund(entry Entry, freeAttempts int) Entry {
+	if entry.Failures > 0 {
+		entry.Failures--
+	}
+	if entry.Failures <= freeAttempts {
+		entry.BlockedUntil = time.Time{}
+	}
+	return entry
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// MemoryStore keeps entries in process memory, so they are per instance and lost on restart
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+	maxAge  time.Duration
+	clock   Clock
+	writes  int
+}
+
+// Create a memory store that drops entries whose last failure is older than maxAge
+func NewMemoryStore(maxAge time.Duration, clock Clock) *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]Entry),
+		maxAge:  maxAge,
+		clock:   clock,
+	}
+}
+
+func (s *MemoryStore) Get(key string) (Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	return entry, ok
+}
+
+func (s *MemoryStore) Set(key string, entry Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = entry
+
+	// Prune stale entries now and then so the map does not grow forever
+	s.writes++
+	if s.writes%1000 == 0 {
+		now := s.clock.Now()
+		for k, e := range s.entries {
+			if now.Sub(e.LastFailure) > s.maxAge && !now.Before(e.LockedUntil) {
+				delete(s.entries, k)
+			}
+		}
+	}
+}
+
+func (s *MemoryStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+}
@@ -0,0 +1,94 @@
+package token_service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+// Generate an unguessable URL-safe token
+func GenerateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Hash a token for storage, so a leaked table cannot be used to redeem tokens
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Sign a payload together with its expiry time, the result can be verified without storing it
+func SignToken(secret []byte, payload string, expiresAt time.Time) string {
+	body := base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+	return body + "." + base64.RawURLEncoding.EncodeToString(sign(secret, body))
+}
+
+// Check the signature and expiry of a signed token and return its payload
+func VerifySignedToken(secret []byte, token string, now time.Time) (string, error) {
+	i := strings.LastIndex(token, ".")
+	if i < 0 {
+		return "", ErrInvalidToken
+	}
+	body, signature := token[:i], token[i+1:]
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, sign(secret, body)) {
+		return "", ErrInvalidToken
+	}
+
+	parts := strings.SplitN(body, ".", 2)
+	if len(parts) != 2 {
+		return "", ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	if now.Unix() > expiresAt {
+		return "", ErrExpiredToken
+	}
+
+	return string(payload), nil
+}
+
+// Derive a 32 byte key for one purpose from a shared secret with HKDF-SHA256 (RFC 5869),
+// so keys for different labels cannot be used in place of each other or of the secret
+func DeriveKey(secret []byte, label string) []byte {
+	// Extract with an empty salt, which HMAC pads to a block of zeros
+	extract := hmac.New(sha256.New, nil)
+	extract.Write(secret)
+	prk := extract.Sum(nil)
+
+	// One block of the expand step is as long as the key
+	expand := hmac.New(sha256.New, prk)
+	expand.Write([]byte(label))
+	expand.Write([]byte{1})
+	return expand.Sum(nil)
+}
+
+func sign(secret []byte, body string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(body))
+	return h.Sum(nil)
+}
@@ -0,0 +1,31 @@
+package trash_service
+
+import (
+	"log"
+	"time"
+
+	"github.com/Akhanrok/go_labs/repositories/list_repository"
+)
+
+// Retention is how long deleted lists are kept for the given number of days
+func Retention(days int) time.Duration {
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Purge lists that have been in the trash longer than retention, checking every interval.
+// Runs until the process exits.
+func PurgeExpired(repo list_repository.ListRepository, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purged, err := repo.PurgeDeletedBefore(time.Now().UTC().Add(-retention))
+		if err != nil {
+			log.Printf("failed to purge deleted lists: %v", err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("purged %d deleted lists", purged)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Check off products and keep the open lists up to date with the changes of other users.
+// Lists are <section data-list-id> elements; with data-live="notice" changes are only announced.
+(function() {
+    var csrfToken = document.querySelector('meta[name="csrf-token"]').content;
+
+    function section(listId) {
+        return document.querySelector('[data-list-id="' + listId + '"]');
+    }
+
+    function updateProgress(list) {
+        var progress = list.querySelector(".progress");
+        if (!progress) {
+            return;
+        }
+        var total = list.querySelectorAll("tr[data-product-id]").length;
+        var done = list.querySelectorAll("tr[data-product-id].purchased").length;
+        progress.textContent = done + "/" + total + " done";
+    }
+
+    function fillRow(row, list, product) {
+        row.dataset.productId = product.id;
+        row.classList.toggle("purchased", product.purchased);
+        row.querySelector(".product-name").textContent = product.product;
+        row.querySelector(".product-quantity").textContent = product.quantity;
+        row.querySelector(".product-store").textContent = product.store;
+
+        var checkbox = row.querySelector(".purchased-toggle");
+        checkbox.dataset.list = list.dataset.listId;
+        checkbox.dataset.product = product.id;
+        checkbox.checked = product.purchased;
+        checkbox.disabled = list.dataset.canEdit !== "true";
+    }
+
+    function newRow() {
+        var row = document.createElement("tr");
+        row.innerHTML = '<td><input type="checkbox" class="purchased-toggle"></td>' +
+            '<td class="product-name"></td><td class="product-quantity"></td><td class="product-store"></td>';
+        return row;
+    }
+
+    document.addEventListener("change", function(event) {
+        var checkbox = event.target;
+        if (!checkbox.classList.contains("purchased-toggle")) {
+            return;
+        }
+
+        var form = new URLSearchParams();
+        form.append("id", checkbox.dataset.list);
+        form.append("productId", checkbox.dataset.product);
+        form.append("purchased", checkbox.checked);
+
+        fetch("/toggle-product", {
+            method: "POST",
+            headers: {"Accept": "application/json", "X-CSRF-Token": csrfToken},
+            body: form
+        }).then(function(response) {
+            if (!response.ok) {
+                throw new Error(response.statusText);
+            }
+            return response.json();
+        }).then(function(progress) {
+            document.getElementById("progress-" + checkbox.dataset.list).textContent = progress.done + "/" + progress.total + " done";
+            checkbox.closest("tr").classList.toggle("purchased", progress.purchased);
+            if (progress.archived) {
+                location.reload();
+            }
+        }).catch(function() {
+            checkbox.checked = !checkbox.checked;
+        });
+    });
+
+    var lists = document.querySelectorAll("[data-list-id]");
+    if (lists.length === 0 || !window.EventSource) {
+        return;
+    }
+
+    var query = Array.prototype.map.call(lists, function(list) {
+        return "id=" + encodeURIComponent(list.dataset.listId);
+    }).join("&");
+    var source = new EventSource("/list-events?" + query);
+
+    function on(type, handler) {
+        source.addEventListener(type, function(event) {
+            var data = JSON.parse(event.data);
+            var list = section(data.listId);
+            if (!list) {
+                return;
+            }
+            if (list.dataset.live === "notice") {
+                document.querySelector(".live-notice").hidden = false;
+                return;
+            }
+            handler(list, data);
+        });
+    }
+
+    on("product-added", function(list, data) {
+        if (list.querySelector('tr[data-product-id="' + data.product.id + '"]')) {
+            return;
+        }
+        var row = newRow();
+        fillRow(row, list, data.product);
+        list.querySelector("tbody").appendChild(row);
+        updateProgress(list);
+    });
+
+    on("product-updated", function(list, data) {
+        var row = list.querySelector('tr[data-product-id="' + data.product.id + '"]');
+        if (row) {
+            fillRow(row, list, data.product);
+            updateProgress(list);
+        }
+    });
+
+    on("product-removed", function(list, data) {
+        var row = list.querySelector('tr[data-product-id="' + data.product.id + '"]');
+        if (row) {
+            row.remove();
+            updateProgress(list);
+        }
+    });
+
+    on("list-renamed", function(list, data) {
+        list.querySelector(".list-name").textContent = data.name;
+    });
+
+    // Moving between the active, archived and deleted lists changes the page layout
+    on("list-archived", function() {
+        location.reload();
+    });
+    on("list-deleted", function() {
+        location.reload();
+    });
+
+    // Changes were lost while disconnected, only a reload shows the current state
+    source.addEventListener("reset", function() {
+        location.reload();
+    });
+})();
@@ -0,0 +1,73 @@
+package config_test
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Akhanrok/go_labs/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSessionKeys(t *testing.T) {
+	newHashKey := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32)))
+	newBlockKey := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("b", 16)))
+	oldHashKey := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("c", 64)))
+
+	pairs, err := config.ParseSessionKeys(newHashKey + ":" + newBlockKey + ", " + oldHashKey)
+	assert.NoError(t, err)
+	assert.Len(t, pairs, 4)
+	assert.Equal(t, []byte(strings.Repeat("a", 32)), pairs[0])
+	assert.Equal(t, []byte(strings.Repeat("b", 16)), pairs[1])
+	assert.Equal(t, []byte(strings.Repeat("c", 64)), pairs[2])
+	assert.Nil(t, pairs[3])
+
+	_, err = config.ParseSessionKeys(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.Error(t, err)
+}
+
+func TestLoadSessionOptions(t *testing.T) {
+	t.Setenv("SESSION_COOKIE_NAME", "shopping-session")
+	t.Setenv("SESSION_SECURE", "true")
+	t.Setenv("SESSION_HTTP_ONLY", "false")
+	t.Setenv("SESSION_SAME_SITE", "strict")
+	t.Setenv("SESSION_MAX_AGE", "3600")
+
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "shopping-session", cfg.Session.CookieName)
+	assert.True(t, cfg.Session.Secure)
+	assert.False(t, cfg.Session.HttpOnly)
+	assert.Equal(t, http.SameSiteStrictMode, cfg.Session.SameSite)
+	assert.Equal(t, 3600, cfg.Session.MaxAge)
+
+	t.Setenv("SESSION_SAME_SITE", "sometimes")
+	_, err = config.Load()
+	assert.Error(t, err)
+}
+
+func TestLoadTrashRetention(t *testing.T) {
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, 30, cfg.TrashRetentionDays)
+
+	t.Setenv("TRASH_RETENTION_DAYS", "7")
+	cfg, err = config.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, 7, cfg.TrashRetentionDays)
+
+	t.Setenv("TRASH_RETENTION_DAYS", "0")
+	_, err = config.Load()
+	assert.Error(t, err)
+}
+
+func TestLoadScheduleTimeZone(t *testing.T) {
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "UTC", cfg.ScheduleLocation.String())
+
+	t.Setenv("SCHEDULE_TIMEZONE", "Nowhere/Atlantis")
+	_, err = config.Load()
+	assert.Error(t, err)
+}
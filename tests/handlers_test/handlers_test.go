@@ -1,137 +1,355 @@
-package handlers_test
-
-import (
-	"database/sql"
-	"net/http"
-	"net/http/httptest"
-	"net/url"
-	"strings"
-	"testing"
-
-	"github.com/Akhanrok/go_labs/handlers/list_handlers"
-	"github.com/Akhanrok/go_labs/handlers/user_handlers"
-	"github.com/Akhanrok/go_labs/repositories/user_repository"
-	_ "github.com/go-sql-driver/mysql"
-	"github.com/gorilla/sessions"
-)
-
-var (
-	db    *sql.DB
-	store *sessions.CookieStore
-)
-
-func TestIndexHandler(t *testing.T) {
-	req, err := http.NewRequest("GET", "/", nil)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(user_handlers.IndexHandler)
-
-	handler.ServeHTTP(rr, req)
-
-	if rr.Code != http.StatusOK {
-		t.Errorf("handler returned wrong status code: got %v, want %v", rr.Code, http.StatusOK)
-	}
-
-	expected := "Index Page"
-	if !strings.Contains(rr.Body.String(), expected) {
-		t.Errorf("handler returned unexpected body: got %v, want %v", rr.Body.String(), expected)
-	}
-}
-
-func TestLoginHandlerValidCredentials(t *testing.T) {
-	// Initialize the test database with a user
-	userRepo := user_repository.NewUserRepository(db)
-	_, err := userRepo.ValidateCredentials("test@example.com", "password123")
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	// Create a test login request with valid credentials
-	payload := strings.NewReader("email=test@example.com&password=password123")
-	req, err := http.NewRequest("POST", "/login", payload)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		user_handlers.LoginHandler(w, r, db, store)
-	})
-
-	handler.ServeHTTP(rr, req)
-
-	if rr.Code != http.StatusOK {
-		t.Errorf("handler returned wrong status code: got %v, want %v", rr.Code, http.StatusOK)
-	}
-
-	expected := "Login Success"
-	if !strings.Contains(rr.Body.String(), expected) {
-		t.Errorf("handler returned unexpected body: got %v, want %v", rr.Body.String(), expected)
-	}
-}
-
-func TestLoginHandlerInvalidCredentials(t *testing.T) {
-	// Create a test login request with invalid credentials
-	payload := strings.NewReader("email=test@example.com&password=wrongpassword")
-	req, err := http.NewRequest("POST", "/login", payload)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		user_handlers.LoginHandler(w, r, db, store)
-	})
-
-	handler.ServeHTTP(rr, req)
-
-	if rr.Code != http.StatusUnauthorized {
-		t.Errorf("handler returned wrong status code: got %v, want %v", rr.Code, http.StatusUnauthorized)
-	}
-
-	expected := "Invalid Credentials"
-	if !strings.Contains(rr.Body.String(), expected) {
-		t.Errorf("handler returned unexpected body: got %v, want %v", rr.Body.String(), expected)
-	}
-}
-
-func TestCreateListHandler(t *testing.T) {
-	// Prepare the test request
-	form := url.Values{}
-	form.Set("listName", "Test List")
-	form.Set("product[]", "Product 1")
-	form.Set("quantity[]", "2")
-	form.Set("store[]", "Store 1")
-
-	req, err := http.NewRequest("POST", "/create-list", strings.NewReader(form.Encode()))
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	// Prepare the test response recorder
-	recorder := httptest.NewRecorder()
-
-	// Call the handler function
-	list_handlers.CreateListHandler(recorder, req, db, store)
-
-	// Check the response status code
-	if recorder.Code != http.StatusFound {
-		t.Errorf("Expected status code %d, but got %d", http.StatusFound, recorder.Code)
-	}
-
-	// Check the response header for the redirect location
-	location, err := recorder.Result().Location()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	expectedLocation := "/list-success?name=Test%20List"
-	if location.Path != expectedLocation {
-		t.Errorf("Expected redirect location %s, but got %s", expectedLocation, location.Path)
-	}
-}
+package handlers_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Akhanrok/go_labs/handlers/list_handlers"
+	"github.com/Akhanrok/go_labs/handlers/user_handlers"
+	"github.com/Akhanrok/go_labs/repositories/user_repository"
+	"github.com/Akhanrok/go_labs/services"
+	"github.com/Akhanrok/go_labs/services/session_service"
+	"github.com/Akhanrok/go_labs/services/throttle_service"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/gorilla/sessions"
+)
+
+var (
+	db        *sql.DB
+	store     *sessions.CookieStore
+	throttler = throttle_service.NewThrottler(throttle_service.DefaultConfig, throttle_service.NewMemoryStore(time.Hour, throttle_service.SystemClock), throttle_service.SystemClock)
+)
+
+// Render the templates of the repository root
+func init() {
+	renderer, err := services.NewRenderer(os.DirFS("../.."), false)
+	if err != nil {
+		panic(err)
+	}
+	services.SetRenderer(renderer)
+}
+
+func TestIndexHandler(t *testing.T) {
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(user_handlers.IndexHandler)
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v, want %v", rr.Code, http.StatusOK)
+	}
+
+	expected := "Index Page"
+	if !strings.Contains(rr.Body.String(), expected) {
+		t.Errorf("handler returned unexpected body: got %v, want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestLoginHandlerValidCredentials(t *testing.T) {
+	// Initialize the test database with a user
+	userRepo := user_repository.NewUserRepository(db)
+	_, err := userRepo.ValidateCredentials("test@example.com", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a test login request with valid credentials
+	payload := strings.NewReader("email=test@example.com&password=password123")
+	req, err := http.NewRequest("POST", "/login", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user_handlers.LoginHandler(w, r, db, store, throttler)
+	})
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusFound {
+		t.Errorf("handler returned wrong status code: got %v, want %v", rr.Code, http.StatusFound)
+	}
+
+	expected := "/login-success"
+	if location := rr.Header().Get("Location"); location != expected {
+		t.Errorf("handler returned unexpected redirect: got %v, want %v", location, expected)
+	}
+}
+
+func TestLoginHandlerInvalidCredentials(t *testing.T) {
+	// Create a test login request with invalid credentials
+	payload := strings.NewReader("email=test@example.com&password=wrongpassword")
+	req, err := http.NewRequest("POST", "/login", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user_handlers.LoginHandler(w, r, db, store, throttler)
+	})
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code: got %v, want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	expected := "Invalid Credentials"
+	if !strings.Contains(rr.Body.String(), expected) {
+		t.Errorf("handler returned unexpected body: got %v, want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestCreateListHandler(t *testing.T) {
+	// Prepare the test request
+	form := url.Values{}
+	form.Set("listName", "Test List")
+	form.Set("product[]", "Product 1")
+	form.Set("quantity[]", "2")
+	form.Set("store[]", "Store 1")
+
+	req, err := http.NewRequest("POST", "/create-list", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// Prepare the test response recorder
+	recorder := httptest.NewRecorder()
+
+	// Call the handler function as the authenticated user
+	user := &session_service.SessionUser{ID: 1, Name: "Test User"}
+	req = req.WithContext(session_service.WithUser(req.Context(), user))
+	list_handlers.CreateListHandler(recorder, req, db)
+
+	// Check the response status code
+	if recorder.Code != http.StatusFound {
+		t.Errorf("Expected status code %d, but got %d", http.StatusFound, recorder.Code)
+	}
+
+	// Check the response header for the redirect location
+	location, err := recorder.Result().Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedLocation := "/list-success?name=Test%20List"
+	if location.Path != expectedLocation {
+		t.Errorf("Expected redirect location %s, but got %s", expectedLocation, location.Path)
+	}
+}
+
+func TestCreateListHandlerRejectsInvalidForm(t *testing.T) {
+	// A crafted form with more products than quantities and stores
+	form := url.Values{}
+	form.Set("listName", "")
+	form["product[]"] = []string{"Product 1", "Product 2"}
+	form["quantity[]"] = []string{"0"}
+	form["store[]"] = []string{"Store 1"}
+
+	req, err := http.NewRequest("POST", "/create-list", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// Prepare the test response recorder
+	recorder := httptest.NewRecorder()
+
+	// Call the handler function as the authenticated user
+	user := &session_service.SessionUser{ID: 1, Name: "Test User"}
+	req = req.WithContext(session_service.WithUser(req.Context(), user))
+	list_handlers.CreateListHandler(recorder, req, templatesDB(t))
+
+	// The form is shown again with an error per field, the input kept and the template picker
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d", http.StatusOK, recorder.Code)
+	}
+
+	body := recorder.Body.String()
+	for _, expected := range []string{
+		"Every product needs a name, quantity and store",
+		"List name is required",
+		"Quantity should be a number from 1 to",
+		"Store is required",
+		`value="Product 2"`,
+		"Start from a template:",
+		"Weekly shop (0 products)",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected body to contain %q", expected)
+		}
+	}
+}
+
+func TestSharedListHandlerRejectsMissingToken(t *testing.T) {
+	req, err := http.NewRequest("GET", "/shared-list", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	list_handlers.SharedListHandler(recorder, req, db)
+
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, but got %d", http.StatusNotFound, recorder.Code)
+	}
+
+	// The token must not leak to other sites through the Referer header
+	if policy := recorder.Header().Get("Referrer-Policy"); policy != "no-referrer" {
+		t.Errorf("Expected Referrer-Policy no-referrer, but got %q", policy)
+	}
+
+	expected := "This link is invalid, has expired or has been revoked"
+	if !strings.Contains(recorder.Body.String(), expected) {
+		t.Errorf("Expected body to contain %q", expected)
+	}
+}
+
+func TestSearchHandlerWithoutTerms(t *testing.T) {
+	// Only punctuation, nothing to search for
+	req, err := http.NewRequest("GET", "/search?q="+url.QueryEscape(`"*"`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+
+	// Call the handler function as the authenticated user
+	user := &session_service.SessionUser{ID: 1, Name: "Test User"}
+	req = req.WithContext(session_service.WithUser(req.Context(), user))
+	list_handlers.SearchHandler(recorder, req, db)
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d", http.StatusOK, recorder.Code)
+	}
+
+	expected := `Nothing found for "&#34;*&#34;".`
+	if !strings.Contains(recorder.Body.String(), expected) {
+		t.Errorf("Expected body to contain %q, got %s", expected, recorder.Body.String())
+	}
+}
+
+func TestViewListsHandlerRejectsInvalidPaging(t *testing.T) {
+	for _, query := range []string{"sort=price", "sort=name&after=not-a-cursor"} {
+		req, err := http.NewRequest("GET", "/view-lists?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+
+		// Call the handler function as the authenticated user
+		user := &session_service.SessionUser{ID: 1, Name: "Test User"}
+		req = req.WithContext(session_service.WithUser(req.Context(), user))
+		list_handlers.ViewListsHandler(recorder, req, db)
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, but got %d", query, http.StatusBadRequest, recorder.Code)
+		}
+	}
+}
+
+// A database that only answers the queries for the templates of a user, with one template
+// without items
+type templatesDriver struct{}
+
+type templatesConn struct{}
+
+type templatesStmt struct {
+	query string
+}
+
+type templatesRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func init() {
+	sql.Register("templates", templatesDriver{})
+}
+
+func templatesDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("templates", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func (templatesDriver) Open(name string) (driver.Conn, error) {
+	return templatesConn{}, nil
+}
+
+func (templatesConn) Prepare(query string) (driver.Stmt, error) {
+	return templatesStmt{query}, nil
+}
+
+func (templatesConn) Close() error {
+	return nil
+}
+
+func (templatesConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+func (s templatesStmt) Close() error {
+	return nil
+}
+
+func (s templatesStmt) NumInput() int {
+	return -1
+}
+
+func (s templatesStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("only queries are supported")
+}
+
+func (s templatesStmt) Query(args []driver.Value) (driver.Rows, error) {
+	switch {
+	case strings.HasPrefix(s.query, "SELECT id, name, created_at FROM list_templates"):
+		return &templatesRows{
+			columns: []string{"id", "name", "created_at"},
+			values:  [][]driver.Value{{int64(1), "Weekly shop", time.Now()}},
+		}, nil
+	case strings.Contains(s.query, "FROM list_template_items"):
+		return &templatesRows{columns: []string{"template_id", "id", "name", "quantity", "store"}}, nil
+	}
+	return nil, errors.New("unexpected query: " + s.query)
+}
+
+func (r *templatesRows) Columns() []string {
+	return r.columns
+}
+
+func (r *templatesRows) Close() error {
+	return nil
+}
+
+func (r *templatesRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
@@ -0,0 +1,252 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Akhanrok/go_labs/config"
+	"github.com/Akhanrok/go_labs/handlers/list_handlers"
+	"github.com/Akhanrok/go_labs/handlers/middleware"
+	"github.com/Akhanrok/go_labs/repositories/user_repository"
+	"github.com/Akhanrok/go_labs/services/csrf_service"
+	"github.com/Akhanrok/go_labs/services/session_service"
+	"github.com/gorilla/sessions"
+)
+
+func TestRequireAuthRedirectsAnonymousUsers(t *testing.T) {
+	cookieStore := sessions.NewCookieStore([]byte("test-secret-key"))
+
+	req, err := http.NewRequest("GET", "/view-lists", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := middleware.RequireAuth(cookieStore, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be called for anonymous users")
+	})
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusFound {
+		t.Errorf("handler returned wrong status code: got %v, want %v", rr.Code, http.StatusFound)
+	}
+
+	expected := "/login?next=%2Fview-lists"
+	if location := rr.Header().Get("Location"); location != expected {
+		t.Errorf("handler returned unexpected redirect: got %v, want %v", location, expected)
+	}
+}
+
+func TestRequireAuthPutsUserInContext(t *testing.T) {
+	cookieStore := sessions.NewCookieStore([]byte("test-secret-key"))
+
+	// Log the user in to obtain a session cookie
+	loginReq, err := http.NewRequest("POST", "/login", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loginRR := httptest.NewRecorder()
+	err = session_service.SetUser(loginRR, loginReq, cookieStore, session_service.SessionUser{ID: 7, Name: "Test User"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", "/view-lists", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cookie := range loginRR.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+
+	rr := httptest.NewRecorder()
+	called := false
+	handler := middleware.RequireAuth(cookieStore, func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		user, ok := session_service.UserFromContext(r.Context())
+		if !ok || user.ID != 7 {
+			t.Errorf("expected user 7 in the request context, got %v", user)
+		}
+	})
+
+	handler.ServeHTTP(rr, req)
+
+	if !called {
+		t.Error("handler was not called for an authenticated user")
+	}
+}
+
+func TestCSRFRejectsPostWithoutToken(t *testing.T) {
+	cookieStore := sessions.NewCookieStore([]byte("test-secret-key"))
+
+	req, err := http.NewRequest("POST", "/create-list", strings.NewReader("listName=Test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	handler := middleware.CSRF(cookieStore, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be called without a CSRF token")
+	}))
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("handler returned wrong status code: got %v, want %v", rr.Code, http.StatusForbidden)
+	}
+}
+
+func TestCSRFDoesNotCreateSessionUnlessAsked(t *testing.T) {
+	cookieStore := sessions.NewCookieStore([]byte("test-secret-key"))
+
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := middleware.CSRF(cookieStore, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	handler.ServeHTTP(rr, req)
+
+	if cookies := rr.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("expected no session cookie for a page without forms, got %v", cookies)
+	}
+}
+
+func TestCSRFAcceptsPostWithToken(t *testing.T) {
+	cookieStore := sessions.NewCookieStore([]byte("test-secret-key"))
+
+	// A safe request issues the token when the page asks for it
+	var token string
+	handler := middleware.CSRF(cookieStore, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			var err error
+			token, err = csrf_service.TokenFromContext(r.Context())
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}))
+
+	getReq, err := http.NewRequest("GET", "/create-list", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getRR := httptest.NewRecorder()
+	handler.ServeHTTP(getRR, getReq)
+
+	if token == "" {
+		t.Fatal("expected a CSRF token in the request context")
+	}
+
+	form := url.Values{}
+	form.Set("listName", "Test")
+	form.Set(csrf_service.FieldName, token)
+
+	postReq, err := http.NewRequest("POST", "/create-list", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	postReq.Host = "localhost:8080"
+	postReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	postReq.Header.Set("Origin", "http://localhost:8080")
+	for _, cookie := range getRR.Result().Cookies() {
+		postReq.AddCookie(cookie)
+	}
+
+	postRR := httptest.NewRecorder()
+	handler.ServeHTTP(postRR, postReq)
+
+	if postRR.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v, want %v", postRR.Code, http.StatusOK)
+	}
+
+	// The same token is refused when the request comes from another site
+	postReq.Header.Set("Origin", "http://evil.example.com")
+	crossRR := httptest.NewRecorder()
+	handler.ServeHTTP(crossRR, postReq)
+
+	if crossRR.Code != http.StatusForbidden {
+		t.Errorf("handler returned wrong status code: got %v, want %v", crossRR.Code, http.StatusForbidden)
+	}
+}
+
+// Users whose email was never verified and who registered long ago
+type unverifiedUsers struct {
+	user_repository.UserRepository
+}
+
+func (unverifiedUsers) GetUserByID(userID int) (*user_repository.User, error) {
+	return &user_repository.User{ID: userID, Email: "test@example.com", CreatedAt: time.Now().Add(-30 * 24 * time.Hour)}, nil
+}
+
+func TestListRoutesRequireVerifiedEmail(t *testing.T) {
+	cookieStore := sessions.NewCookieStore([]byte("test-secret-key"))
+
+	mux := http.NewServeMux()
+	routes := list_handlers.Routes(nil, cookieStore, nil, nil, &config.Config{})
+	list_handlers.RegisterRoutes(mux, routes, cookieStore, unverifiedUsers{}, 72*time.Hour)
+
+	// Every route that changes lists has to be among the registered ones
+	paths := make(map[string]bool)
+	for _, route := range routes {
+		paths[route.Path] = true
+	}
+	for _, path := range []string{"/create-list", "/rename-list", "/add-product", "/update-product", "/remove-product",
+		"/toggle-product", "/duplicate-list", "/merge-lists", "/save-list-template", "/delete-list-template",
+		"/set-list-schedule", "/remove-list-schedule", "/purchase-store-item", "/set-auto-archive", "/share-list",
+		"/accept-invitation", "/revoke-invitation", "/remove-member", "/create-share-link", "/revoke-share-link",
+		"/delete-list", "/restore-list", "/purge-list"} {
+		if !paths[path] {
+			t.Errorf("%s is not registered with the list routes", path)
+		}
+	}
+
+	loginReq, err := http.NewRequest("POST", "/login", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loginRR := httptest.NewRecorder()
+	err = session_service.SetUser(loginRR, loginReq, cookieStore, session_service.SessionUser{ID: 7, Name: "Test User"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, route := range routes {
+		// Anonymous users are sent to the login page
+		req, err := http.NewRequest("POST", route.Path, strings.NewReader("listID=1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusFound {
+			t.Errorf("POST %s by an anonymous user: got %v, want %v", route.Path, rr.Code, http.StatusFound)
+		}
+
+		// Unverified users past the grace period cannot change anything
+		req, err = http.NewRequest("POST", route.Path, strings.NewReader("listID=1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, cookie := range loginRR.Result().Cookies() {
+			req.AddCookie(cookie)
+		}
+
+		rr = httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("POST %s by an unverified user: got %v, want %v", route.Path, rr.Code, http.StatusForbidden)
+		}
+	}
+}
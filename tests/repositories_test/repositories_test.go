@@ -1,174 +1,865 @@
-package repositories_test
-
-import (
-	"database/sql"
-	"testing"
-
-	"github.com/Akhanrok/go_labs/repositories/database_repository"
-	"github.com/Akhanrok/go_labs/repositories/list_repository"
-	"github.com/Akhanrok/go_labs/repositories/product_repository"
-	"github.com/Akhanrok/go_labs/repositories/user_repository"
-	_ "github.com/go-sql-driver/mysql"
-)
-
-func TestNewDatabase(t *testing.T) {
-	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
-
-	// Call the NewDatabase function
-	db, err := database_repository.NewDatabase(dataSourceName)
-
-	// Check if there was an error creating the database connection
-	if err != nil {
-		t.Errorf("failed to create database connection: %v", err)
-	}
-
-	// Check if the database connection is not nil
-	if db == nil {
-		t.Error("database connection is nil")
-	}
-
-	db.Close()
-}
-
-func TestIsListExists(t *testing.T) {
-	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
-
-	// Create a database connection
-	db, err := sql.Open("mysql", dataSourceName)
-	if err != nil {
-		t.Fatalf("failed to open database connection: %v", err)
-	}
-	defer db.Close()
-
-	// Create an instance of the listRepository
-	repo := list_repository.NewListRepository(db)
-
-	// Define the test parameters
-	userID := 1
-	listName := "example list"
-
-	// Call the IsListExists function
-	exists, err := repo.IsListExists(userID, listName)
-
-	// Check if there was an error
-	if err != nil {
-		t.Errorf("failed to check list existence: %v", err)
-	}
-
-	if exists {
-		t.Errorf("expected list '%s' for user %d to not exist, but it exists", listName, userID)
-	}
-}
-
-func TestGetListsData(t *testing.T) {
-	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
-
-	// Create a database connection
-	db, err := sql.Open("mysql", dataSourceName)
-	if err != nil {
-		t.Fatalf("failed to open database connection: %v", err)
-	}
-	defer db.Close()
-
-	// Create an instance of the listRepository
-	repo := list_repository.NewListRepository(db)
-
-	// Define the test parameter
-	userID := 1
-
-	// Call the GetListsData function
-	lists, err := repo.GetListsData(userID)
-
-	if err != nil {
-		t.Errorf("failed to get lists data: %v", err)
-	}
-
-	if len(lists) == 0 {
-		t.Errorf("expected to get lists data for user %d, but received an empty list", userID)
-	}
-}
-
-func TestValidateCredentials(t *testing.T) {
-	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
-
-	// Create a database connection
-	db, err := sql.Open("mysql", dataSourceName)
-	if err != nil {
-		t.Fatalf("failed to open database connection: %v", err)
-	}
-	defer db.Close()
-
-	// Create an instance of the userRepository
-	repo := user_repository.NewUserRepository(db)
-
-	// Define the test parameters
-	email := "test@example.com"
-	password := "password"
-
-	// Call the ValidateCredentials function
-	username, err := repo.ValidateCredentials(email, password)
-
-	if err != nil {
-		t.Errorf("failed to validate credentials: %v", err)
-	}
-
-	if username != "expectedUsername" {
-		t.Errorf("expected username 'expectedUsername', but received '%s'", username)
-	}
-}
-
-func TestIsEmailExists(t *testing.T) {
-	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
-
-	// Create a database connection
-	db, err := sql.Open("mysql", dataSourceName)
-	if err != nil {
-		t.Fatalf("failed to open database connection: %v", err)
-	}
-	defer db.Close()
-
-	// Create an instance of the userRepository
-	repo := user_repository.NewUserRepository(db)
-
-	// Define the test parameter
-	email := "test@example.com"
-
-	// Call the IsEmailExists function
-	exists, err := repo.IsEmailExists(email)
-
-	if err != nil {
-		t.Errorf("failed to check email existence: %v", err)
-	}
-
-	if !exists {
-		t.Errorf("expected email '%s' to exist, but it does not exist", email)
-	}
-}
-
-func TestGetProductsData(t *testing.T) {
-	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
-
-	// Create a database connection
-	db, err := sql.Open("mysql", dataSourceName)
-	if err != nil {
-		t.Fatalf("failed to open database connection: %v", err)
-	}
-	defer db.Close()
-
-	// Create an instance of the productRepository
-	repo := product_repository.NewProductRepository(db)
-
-	// Define the test parameter
-	listID := 1
-
-	// Call the GetProductsData function
-	products, err := repo.GetProductsData(listID)
-
-	if err != nil {
-		t.Errorf("failed to get products data: %v", err)
-	}
-
-	if len(products) == 0 {
-		t.Errorf("expected to get products data for list %d, but received an empty list", listID)
-	}
-}
+package repositories_test
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Akhanrok/go_labs/repositories/database_repository"
+	"github.com/Akhanrok/go_labs/repositories/list_invitation_repository"
+	"github.com/Akhanrok/go_labs/repositories/list_member_repository"
+	"github.com/Akhanrok/go_labs/repositories/list_repository"
+	"github.com/Akhanrok/go_labs/repositories/list_template_repository"
+	"github.com/Akhanrok/go_labs/repositories/product_repository"
+	"github.com/Akhanrok/go_labs/repositories/share_link_repository"
+	"github.com/Akhanrok/go_labs/repositories/user_repository"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func TestNewDatabase(t *testing.T) {
+	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
+
+	// Call the NewDatabase function
+	db, err := database_repository.NewDatabase(dataSourceName)
+
+	// Check if there was an error creating the database connection
+	if err != nil {
+		t.Errorf("failed to create database connection: %v", err)
+	}
+
+	// Check if the database connection is not nil
+	if db == nil {
+		t.Error("database connection is nil")
+	}
+
+	db.Close()
+}
+
+func TestIsListExists(t *testing.T) {
+	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
+
+	// Create a database connection
+	db, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		t.Fatalf("failed to open database connection: %v", err)
+	}
+	defer db.Close()
+
+	// Create an instance of the listRepository
+	repo := list_repository.NewListRepository(db)
+
+	// Define the test parameters
+	userID := 1
+	listName := "example list"
+
+	// Call the IsListExists function
+	exists, err := repo.IsListExists(userID, listName)
+
+	// Check if there was an error
+	if err != nil {
+		t.Errorf("failed to check list existence: %v", err)
+	}
+
+	if exists {
+		t.Errorf("expected list '%s' for user %d to not exist, but it exists", listName, userID)
+	}
+}
+
+func TestGetListsData(t *testing.T) {
+	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
+
+	// Create a database connection
+	db, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		t.Fatalf("failed to open database connection: %v", err)
+	}
+	defer db.Close()
+
+	// Create an instance of the listRepository
+	repo := list_repository.NewListRepository(db)
+
+	// Define the test parameter
+	userID := 1
+
+	// Call the GetListsData function
+	lists, err := repo.GetListsData(userID)
+
+	if err != nil {
+		t.Errorf("failed to get lists data: %v", err)
+	}
+
+	if len(lists) == 0 {
+		t.Errorf("expected to get lists data for user %d, but received an empty list", userID)
+	}
+}
+
+func TestValidateCredentials(t *testing.T) {
+	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
+
+	// Create a database connection
+	db, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		t.Fatalf("failed to open database connection: %v", err)
+	}
+	defer db.Close()
+
+	// Create an instance of the userRepository
+	repo := user_repository.NewUserRepository(db)
+
+	// Define the test parameters
+	email := "test@example.com"
+	password := "password"
+
+	// Call the ValidateCredentials function
+	user, err := repo.ValidateCredentials(email, password)
+
+	if err != nil {
+		t.Errorf("failed to validate credentials: %v", err)
+	}
+
+	if user == nil || user.Name != "expectedUsername" {
+		t.Errorf("expected username 'expectedUsername', but received %v", user)
+	}
+}
+
+func TestIsEmailExists(t *testing.T) {
+	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
+
+	// Create a database connection
+	db, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		t.Fatalf("failed to open database connection: %v", err)
+	}
+	defer db.Close()
+
+	// Create an instance of the userRepository
+	repo := user_repository.NewUserRepository(db)
+
+	// Define the test parameter
+	email := "test@example.com"
+
+	// Call the IsEmailExists function
+	exists, err := repo.IsEmailExists(email)
+
+	if err != nil {
+		t.Errorf("failed to check email existence: %v", err)
+	}
+
+	if !exists {
+		t.Errorf("expected email '%s' to exist, but it does not exist", email)
+	}
+}
+
+func TestGetProductsData(t *testing.T) {
+	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
+
+	// Create a database connection
+	db, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		t.Fatalf("failed to open database connection: %v", err)
+	}
+	defer db.Close()
+
+	// Create an instance of the productRepository
+	repo := product_repository.NewProductRepository(db)
+
+	// Define the test parameter
+	listID := 1
+
+	// Call the GetProductsData function
+	products, err := repo.GetProductsData(listID)
+
+	if err != nil {
+		t.Errorf("failed to get products data: %v", err)
+	}
+
+	if len(products) == 0 {
+		t.Errorf("expected to get products data for list %d, but received an empty list", listID)
+	}
+}
+
+func TestEditProducts(t *testing.T) {
+	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
+
+	// Create a database connection
+	db, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		t.Fatalf("failed to open database connection: %v", err)
+	}
+	defer db.Close()
+
+	// Create an instance of the productRepository
+	repo := product_repository.NewProductRepository(db)
+
+	// Define the test parameter
+	listID := 1
+
+	// Add a product and check it is returned with its ID
+	productID, err := repo.AddProduct(listID, product_repository.Product{Product: "Test product", Quantity: 1, Store: "Test store"})
+	if err != nil {
+		t.Fatalf("failed to add product: %v", err)
+	}
+
+	err = repo.UpdateProduct(listID, product_repository.Product{ID: productID, Product: "Test product", Quantity: 3, Store: "Other store", Version: 1})
+	if err != nil {
+		t.Errorf("failed to update product: %v", err)
+	}
+
+	// A second save based on the first version would overwrite the update
+	err = repo.UpdateProduct(listID, product_repository.Product{ID: productID, Product: "Test product", Quantity: 5, Store: "Test store", Version: 1})
+	if err != product_repository.ErrVersionConflict {
+		t.Errorf("expected a version conflict, got %v", err)
+	}
+
+	products, err := repo.GetProductsData(listID)
+	if err != nil {
+		t.Fatalf("failed to get products data: %v", err)
+	}
+
+	found := false
+	for _, product := range products {
+		if product.ID == productID {
+			found = true
+			if product.Quantity != 3 || product.Store != "Other store" || product.Version != 2 {
+				t.Errorf("product was not updated: %+v", product)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("expected product %d in list %d", productID, listID)
+	}
+
+	err = repo.RemoveProduct(listID, productID, 2)
+	if err != nil {
+		t.Errorf("failed to remove product: %v", err)
+	}
+}
+
+func TestDeleteAndRestoreList(t *testing.T) {
+	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
+
+	// Create a database connection
+	db, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		t.Fatalf("failed to open database connection: %v", err)
+	}
+	defer db.Close()
+
+	// Create an instance of the listRepository
+	repo := list_repository.NewListRepository(db)
+
+	// Define the test parameters
+	userID := 1
+	listID := 1
+
+	err = repo.DeleteList(userID, listID)
+	if err != nil {
+		t.Fatalf("failed to delete list: %v", err)
+	}
+
+	// A deleted list is only visible in the trash
+	list, err := repo.GetList(userID, listID)
+	if err != nil {
+		t.Errorf("failed to get list: %v", err)
+	}
+	if list != nil {
+		t.Errorf("expected deleted list %d to be hidden", listID)
+	}
+
+	deleted, err := repo.GetDeletedLists(userID)
+	if err != nil {
+		t.Errorf("failed to get deleted lists: %v", err)
+	}
+	if len(deleted) == 0 {
+		t.Errorf("expected list %d in the trash", listID)
+	}
+
+	err = repo.RestoreList(userID, listID)
+	if err != nil {
+		t.Errorf("failed to restore list: %v", err)
+	}
+}
+
+func TestPurchasedCount(t *testing.T) {
+	list := list_repository.ListData{
+		Products: []product_repository.Product{
+			{Product: "Milk", Purchased: true},
+			{Product: "Bread"},
+			{Product: "Eggs", Purchased: true},
+		},
+	}
+
+	if count := list.PurchasedCount(); count != 2 {
+		t.Errorf("expected 2 purchased products, got %d", count)
+	}
+}
+
+func TestListETag(t *testing.T) {
+	list := list_repository.ListData{
+		ID:      1,
+		Version: 1,
+		Products: []product_repository.Product{
+			{ID: 1, Product: "Milk", Version: 1},
+			{ID: 2, Product: "Bread", Version: 1},
+		},
+	}
+	etag := list.ETag()
+
+	if !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) {
+		t.Errorf("expected a quoted ETag, got %s", etag)
+	}
+
+	// Any saved change of the list or one of its products gives a new ETag
+	changed := list
+	changed.Version = 2
+	if changed.ETag() == etag {
+		t.Errorf("expected the ETag to change with the list version")
+	}
+
+	changed = list
+	changed.Products = []product_repository.Product{list.Products[0], {ID: 2, Product: "Bread", Version: 2}}
+	if changed.ETag() == etag {
+		t.Errorf("expected the ETag to change with a product version")
+	}
+
+	changed = list
+	changed.Products = list.Products[:1]
+	if changed.ETag() == etag {
+		t.Errorf("expected the ETag to change when a product is removed")
+	}
+}
+
+func TestSetPurchased(t *testing.T) {
+	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
+
+	// Create a database connection
+	db, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		t.Fatalf("failed to open database connection: %v", err)
+	}
+	defer db.Close()
+
+	// Create an instance of the productRepository
+	repo := product_repository.NewProductRepository(db)
+
+	// Define the test parameter
+	listID := 1
+
+	productID, err := repo.AddProduct(listID, product_repository.Product{Product: "Test product", Quantity: 1, Store: "Test store"})
+	if err != nil {
+		t.Fatalf("failed to add product: %v", err)
+	}
+	// Checking the product off increases its version
+	defer repo.RemoveProduct(listID, productID, 2)
+
+	err = repo.SetPurchased(listID, productID, true)
+	if err != nil {
+		t.Fatalf("failed to check product off: %v", err)
+	}
+
+	products, err := repo.GetProductsData(listID)
+	if err != nil {
+		t.Fatalf("failed to get products data: %v", err)
+	}
+
+	for _, product := range products {
+		if product.ID == productID && (!product.Purchased || product.PurchasedAt.IsZero()) {
+			t.Errorf("expected product %d to be purchased", productID)
+		}
+	}
+}
+
+func TestHasRole(t *testing.T) {
+	// Each role can do everything the lower roles can
+	if !list_member_repository.HasRole(list_member_repository.RoleOwner, list_member_repository.RoleEditor) {
+		t.Error("expected owners to be allowed to edit")
+	}
+	if !list_member_repository.HasRole(list_member_repository.RoleEditor, list_member_repository.RoleViewer) {
+		t.Error("expected editors to be allowed to view")
+	}
+	if list_member_repository.HasRole(list_member_repository.RoleViewer, list_member_repository.RoleEditor) {
+		t.Error("expected viewers not to be allowed to edit")
+	}
+	if list_member_repository.HasRole("", list_member_repository.RoleViewer) {
+		t.Error("expected users without a role not to be allowed to view")
+	}
+}
+
+func TestSharedListsData(t *testing.T) {
+	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
+
+	// Create a database connection
+	db, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		t.Fatalf("failed to open database connection: %v", err)
+	}
+	defer db.Close()
+
+	// Create instances of the repositories
+	listRepo := list_repository.NewListRepository(db)
+	memberRepo := list_member_repository.NewListMemberRepository(db)
+
+	// Define the test parameters: list 1 of user 1 is shared with user 2
+	listID := 1
+	memberID := 2
+
+	err = memberRepo.AddMember(listID, memberID, list_member_repository.RoleViewer)
+	if err != nil {
+		t.Fatalf("failed to share list: %v", err)
+	}
+	defer memberRepo.RemoveMember(listID, memberID)
+
+	lists, err := listRepo.GetListsData(memberID)
+	if err != nil {
+		t.Fatalf("failed to get lists data: %v", err)
+	}
+
+	found := false
+	for _, list := range lists {
+		if list.ID == listID {
+			found = true
+			if list.Role != list_member_repository.RoleViewer || !list.IsShared() {
+				t.Errorf("expected list %d to be shared with the viewer role, got %q", listID, list.Role)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("expected list %d in the lists of user %d", listID, memberID)
+	}
+}
+
+func TestShareLinks(t *testing.T) {
+	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
+
+	// Create a database connection
+	db, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		t.Fatalf("failed to open database connection: %v", err)
+	}
+	defer db.Close()
+
+	// Create an instance of the shareLinkRepository
+	repo := share_link_repository.NewShareLinkRepository(db)
+
+	// Define the test parameters
+	listID := 1
+	tokenHash := "test-share-link-" + time.Now().Format("20060102150405.000000000")
+
+	err = repo.CreateLink(listID, tokenHash, "test", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to create share link: %v", err)
+	}
+
+	foundListID, err := repo.GetListIDByToken(tokenHash)
+	if err != nil {
+		t.Errorf("failed to look up share link: %v", err)
+	}
+	if foundListID != listID {
+		t.Errorf("expected the link to open list %d, got %d", listID, foundListID)
+	}
+
+	links, err := repo.GetActiveLinks(listID)
+	if err != nil {
+		t.Fatalf("failed to get share links: %v", err)
+	}
+
+	// Revoked links stop working
+	for _, link := range links {
+		err = repo.RevokeLink(listID, link.ID)
+		if err != nil {
+			t.Errorf("failed to revoke share link: %v", err)
+		}
+	}
+
+	foundListID, err = repo.GetListIDByToken(tokenHash)
+	if err != nil {
+		t.Errorf("failed to look up share link: %v", err)
+	}
+	if foundListID != 0 {
+		t.Errorf("expected the revoked link not to open a list, got %d", foundListID)
+	}
+}
+
+func TestListTemplates(t *testing.T) {
+	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
+
+	// Create a database connection
+	db, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		t.Fatalf("failed to open database connection: %v", err)
+	}
+	defer db.Close()
+
+	// Create an instance of the listTemplateRepository
+	repo := list_template_repository.NewListTemplateRepository(db)
+
+	// Define the test parameters
+	userID := 1
+	name := "Test template " + time.Now().Format("20060102150405.000000000")
+	items := []product_repository.Product{
+		{Product: "Milk", Quantity: 2, Store: "Test store"},
+		{Product: "Bread", Quantity: 1, Store: "Test store"},
+	}
+
+	templateID, err := repo.CreateTemplate(userID, name, items)
+	if err != nil {
+		t.Fatalf("failed to create template: %v", err)
+	}
+	defer repo.DeleteTemplate(userID, templateID)
+
+	exists, err := repo.IsTemplateExists(userID, name)
+	if err != nil {
+		t.Errorf("failed to check template name: %v", err)
+	}
+	if !exists {
+		t.Errorf("expected template %s to exist", name)
+	}
+
+	template, err := repo.GetTemplate(userID, templateID)
+	if err != nil {
+		t.Fatalf("failed to get template: %v", err)
+	}
+	if template == nil || len(template.Items) != len(items) || template.Items[0].Product != "Milk" {
+		t.Errorf("template was not saved with its items: %+v", template)
+	}
+
+	// Templates are private to the user who saved them
+	template, err = repo.GetTemplate(userID+1, templateID)
+	if err != nil {
+		t.Errorf("failed to get template: %v", err)
+	}
+	if template != nil {
+		t.Errorf("expected the template to be hidden from other users")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
+
+	// Create a database connection
+	db, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		t.Fatalf("failed to open database connection: %v", err)
+	}
+	defer db.Close()
+
+	// Create instances of the repositories
+	listRepo := list_repository.NewListRepository(db)
+	productRepo := product_repository.NewProductRepository(db)
+
+	// Define the test parameters
+	userID := 1
+	listID := 1
+
+	productID, err := productRepo.AddProduct(listID, product_repository.Product{Product: "Zzsearchable oat milk", Quantity: 1, Store: "Test store"})
+	if err != nil {
+		t.Fatalf("failed to add product: %v", err)
+	}
+	defer productRepo.RemoveProduct(listID, productID, 1)
+
+	// Words are found in any case, also inside other words
+	for _, terms := range [][]string{{"zzsearchable"}, {"searchable", "oat"}} {
+		lists, err := listRepo.Search(userID, terms)
+		if err != nil {
+			t.Fatalf("failed to search %v: %v", terms, err)
+		}
+
+		found := false
+		for _, list := range lists {
+			for _, product := range list.Products {
+				if product.ID == productID {
+					found = true
+				}
+			}
+		}
+		if !found {
+			t.Errorf("expected search %v to find product %d", terms, productID)
+		}
+	}
+}
+
+func TestSearchKeepsBestMatchesPastLimit(t *testing.T) {
+	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
+
+	// Create a database connection
+	db, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		t.Fatalf("failed to open database connection: %v", err)
+	}
+	defer db.Close()
+
+	// Create instances of the repositories
+	listRepo := list_repository.NewListRepository(db)
+	productRepo := product_repository.NewProductRepository(db)
+
+	// Define the test parameters
+	userID := 1
+	listID := 1
+
+	// More weak matches than one search returns, added before the best match so they have lower ids
+	var productIDs []int
+	defer func() {
+		for _, productID := range productIDs {
+			productRepo.RemoveProduct(listID, productID, 1)
+		}
+	}()
+	for i := 0; i < 510; i++ {
+		productID, err := productRepo.AddProduct(listID, product_repository.Product{Product: "Zzrankfiller", Quantity: 1, Store: "Test store"})
+		if err != nil {
+			t.Fatalf("failed to add product: %v", err)
+		}
+		productIDs = append(productIDs, productID)
+	}
+
+	bestID, err := productRepo.AddProduct(listID, product_repository.Product{Product: "Zzrank", Quantity: 1, Store: "Zzrank store"})
+	if err != nil {
+		t.Fatalf("failed to add product: %v", err)
+	}
+	productIDs = append(productIDs, bestID)
+
+	lists, err := listRepo.Search(userID, []string{"zzrank"})
+	if err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+
+	found := false
+	for _, list := range lists {
+		for _, product := range list.Products {
+			if product.ID == bestID {
+				found = true
+			}
+		}
+	}
+	if !found {
+		t.Errorf("expected the search to keep the best match %d", bestID)
+	}
+}
+
+func TestGetListsPage(t *testing.T) {
+	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
+
+	// Create a database connection
+	db, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		t.Fatalf("failed to open database connection: %v", err)
+	}
+	defer db.Close()
+
+	// Create an instance of the listRepository
+	repo := list_repository.NewListRepository(db)
+
+	// Define the test parameter
+	userID := 1
+
+	lists, err := repo.GetListsData(userID)
+	if err != nil {
+		t.Fatalf("failed to get lists data: %v", err)
+	}
+	active := 0
+	for _, list := range lists {
+		if !list.Archived {
+			active++
+		}
+	}
+
+	// Pages of one list each visit every active list exactly once, in every sort order
+	for _, sort := range []string{list_repository.SortName, "-" + list_repository.SortCreated, "-" + list_repository.SortItems} {
+		seen := map[int]bool{}
+		query := list_repository.ListsQuery{Sort: sort, Limit: 1}
+		for {
+			page, err := repo.GetListsPage(userID, query)
+			if err != nil {
+				t.Fatalf("failed to get page of lists sorted by %s: %v", sort, err)
+			}
+
+			for _, list := range page.Lists {
+				if seen[list.ID] {
+					t.Errorf("list %d was returned twice when sorted by %s", list.ID, sort)
+				}
+				seen[list.ID] = true
+			}
+
+			if page.Next == "" {
+				break
+			}
+			query.Cursor = page.Next
+		}
+
+		if len(seen) != active {
+			t.Errorf("expected %d lists sorted by %s, but got %d", active, sort, len(seen))
+		}
+	}
+
+	// A cursor only works for the sort order it was returned for
+	page, err := repo.GetListsPage(userID, list_repository.ListsQuery{Sort: list_repository.SortName, Limit: 1})
+	if err != nil {
+		t.Fatalf("failed to get page of lists: %v", err)
+	}
+	if page.Next != "" {
+		_, err = repo.GetListsPage(userID, list_repository.ListsQuery{Sort: list_repository.SortItems, Cursor: page.Next})
+		if err != list_repository.ErrInvalidCursor {
+			t.Errorf("expected ErrInvalidCursor, but got %v", err)
+		}
+	}
+}
+
+func TestMergeLists(t *testing.T) {
+	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
+
+	// Create a database connection
+	db, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		t.Fatalf("failed to open database connection: %v", err)
+	}
+	defer db.Close()
+
+	// Create an instance of the listRepository
+	repo := list_repository.NewListRepository(db)
+
+	// Define the test parameter
+	userID := 1
+
+	var sources []*list_repository.ListData
+	for _, name := range []string{"Merge source one", "Merge source two"} {
+		listID, err := repo.CreateList(userID, name, []product_repository.Product{{Product: "Milk", Quantity: 1, Store: "Test store"}})
+		if err != nil {
+			t.Fatalf("failed to create list: %v", err)
+		}
+		defer repo.PurgeList(userID, listID)
+
+		list, err := repo.GetList(userID, listID)
+		if err != nil {
+			t.Fatalf("failed to get list: %v", err)
+		}
+		sources = append(sources, list)
+	}
+
+	merge := list_repository.Merge{
+		Name:          "Merged list",
+		Products:      []product_repository.Product{{Product: "Milk", Quantity: 2, Store: "Test store"}},
+		Sources:       map[int]string{sources[0].ID: sources[0].ETag(), sources[1].ID: "\"stale\""},
+		DeleteSources: true,
+	}
+
+	// Nothing is created when a source changed since it was merged
+	_, err = repo.MergeLists(userID, merge)
+	if err != list_repository.ErrVersionConflict {
+		t.Fatalf("expected a version conflict, got %v", err)
+	}
+
+	merge.Sources[sources[1].ID] = sources[1].ETag()
+	listID, err := repo.MergeLists(userID, merge)
+	if err != nil {
+		t.Fatalf("failed to merge lists: %v", err)
+	}
+	defer func() {
+		repo.DeleteList(userID, listID)
+		repo.PurgeList(userID, listID)
+	}()
+
+	list, err := repo.GetList(userID, listID)
+	if err != nil {
+		t.Fatalf("failed to get merged list: %v", err)
+	}
+	if list == nil || len(list.Products) != 1 || list.Products[0].Quantity != 2 {
+		t.Errorf("expected the merged list with 2 milk, got %+v", list)
+	}
+
+	// The sources have been moved to the trash
+	for _, source := range sources {
+		list, err := repo.GetList(userID, source.ID)
+		if err != nil {
+			t.Fatalf("failed to get list: %v", err)
+		}
+		if list != nil {
+			t.Errorf("expected list %d to be in the trash", source.ID)
+		}
+	}
+}
+
+func TestAccessibleListIDs(t *testing.T) {
+	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
+
+	// Create a database connection
+	db, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		t.Fatalf("failed to open database connection: %v", err)
+	}
+	defer db.Close()
+
+	// Create an instance of the listRepository
+	repo := list_repository.NewListRepository(db)
+
+	// Define the test parameters
+	userID := 1
+	listID := 1
+	missingListID := 999999
+
+	ids, err := repo.AccessibleListIDs(userID, []int{listID, missingListID})
+	if err != nil {
+		t.Fatalf("failed to check lists: %v", err)
+	}
+
+	if len(ids) != 1 || ids[0] != listID {
+		t.Errorf("expected only list %d to be accessible, got %v", listID, ids)
+	}
+}
+
+func TestListInvitations(t *testing.T) {
+	dataSourceName := "root:w8-!oY4-taa630-lsKnW0ut@tcp(localhost:3306)/shopping_list_app"
+
+	// Create a database connection
+	db, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		t.Fatalf("failed to open database connection: %v", err)
+	}
+	defer db.Close()
+
+	// Create instances of the repositories
+	invitationRepo := list_invitation_repository.NewListInvitationRepository(db)
+	memberRepo := list_member_repository.NewListMemberRepository(db)
+
+	// Define the test parameters: user 2 is invited to list 1
+	listID := 1
+	memberID := 2
+	tokenHash := strings.Repeat("c", 64)
+
+	err = invitationRepo.CreateInvitation(listID, "invited@example.com", list_member_repository.RoleEditor, tokenHash, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to create invitation: %v", err)
+	}
+
+	invitation, err := invitationRepo.GetInvitationByToken(tokenHash)
+	if err != nil {
+		t.Fatalf("failed to get invitation: %v", err)
+	}
+	if invitation == nil || invitation.ListID != listID || invitation.Role != list_member_repository.RoleEditor {
+		t.Fatalf("expected an editor invitation to list %d, got %+v", listID, invitation)
+	}
+
+	err = invitationRepo.AcceptInvitation(invitation, memberID)
+	if err != nil {
+		t.Fatalf("failed to accept invitation: %v", err)
+	}
+	defer memberRepo.RemoveMember(listID, memberID)
+
+	// The link works only once
+	if err := invitationRepo.AcceptInvitation(invitation, memberID); err != sql.ErrNoRows {
+		t.Errorf("expected a used invitation to be rejected, got %v", err)
+	}
+
+	members, err := memberRepo.GetMembers(listID)
+	if err != nil {
+		t.Fatalf("failed to get members: %v", err)
+	}
+	found := false
+	for _, member := range members {
+		if member.UserID == memberID && member.Role == list_member_repository.RoleEditor {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected user %d to be an editor of list %d", memberID, listID)
+	}
+}
@@ -0,0 +1,85 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/Akhanrok/go_labs/services/event_service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHubDeliversEventsOfFollowedLists(t *testing.T) {
+	hub := event_service.NewHub()
+
+	sub, err := hub.Subscribe([]int{1, 2}, 0)
+	assert.NoError(t, err)
+	defer sub.Close()
+	assert.False(t, sub.Reset)
+	assert.Empty(t, sub.Replay)
+
+	assert.NoError(t, hub.Publish(1, event_service.ListRenamed, map[string]string{"name": "Weekend"}))
+	assert.NoError(t, hub.Publish(3, event_service.ListRenamed, map[string]string{"name": "Other"}))
+	assert.NoError(t, hub.Publish(2, event_service.ListDeleted, nil))
+
+	// Events of lists that are not followed are not delivered
+	event := <-sub.Events
+	assert.Equal(t, 1, event.ListID)
+	assert.Equal(t, event_service.ListRenamed, event.Type)
+	assert.JSONEq(t, `{"name":"Weekend"}`, string(event.Data))
+
+	event = <-sub.Events
+	assert.Equal(t, 2, event.ListID)
+	assert.Equal(t, event_service.ListDeleted, event.Type)
+}
+
+func TestHubReplaysMissedEvents(t *testing.T) {
+	hub := event_service.NewHub()
+
+	first, err := hub.Subscribe([]int{1, 2}, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, hub.Publish(1, event_service.ProductAdded, nil))
+	seen := <-first.Events
+	first.Close()
+
+	// Changes made while the browser was disconnected
+	assert.NoError(t, hub.Publish(2, event_service.ProductAdded, nil))
+	assert.NoError(t, hub.Publish(1, event_service.ProductRemoved, nil))
+
+	sub, err := hub.Subscribe([]int{1, 2}, seen.ID)
+	assert.NoError(t, err)
+	defer sub.Close()
+
+	assert.False(t, sub.Reset)
+	if assert.Len(t, sub.Replay, 2) {
+		// Events of several lists are replayed in the order they happened
+		assert.Equal(t, 2, sub.Replay[0].ListID)
+		assert.Equal(t, 1, sub.Replay[1].ListID)
+		assert.Less(t, sub.Replay[0].ID, sub.Replay[1].ID)
+	}
+}
+
+func TestHubResetsWhenMissedEventsAreGone(t *testing.T) {
+	hub := event_service.NewHub()
+
+	first, err := hub.Subscribe([]int{1}, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, hub.Publish(1, event_service.ProductAdded, nil))
+	seen := <-first.Events
+	first.Close()
+
+	// More changes than the hub keeps for a list
+	for i := 0; i < 150; i++ {
+		assert.NoError(t, hub.Publish(1, event_service.ProductUpdated, nil))
+	}
+
+	sub, err := hub.Subscribe([]int{1}, seen.ID)
+	assert.NoError(t, err)
+	defer sub.Close()
+	assert.True(t, sub.Reset)
+
+	// An ID of another server run is unknown as well
+	restarted := event_service.NewHub()
+	sub, err = restarted.Subscribe([]int{1}, seen.ID+1000)
+	assert.NoError(t, err)
+	defer sub.Close()
+	assert.True(t, sub.Reset)
+}
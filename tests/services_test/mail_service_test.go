@@ -0,0 +1,66 @@
+package services_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Akhanrok/go_labs/services/mail_service"
+	"github.com/Akhanrok/go_labs/services/token_service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriterMailer(t *testing.T) {
+	var buf bytes.Buffer
+	mailer := mail_service.NewWriterMailer(&buf, "no-reply@example.com")
+
+	err := mailer.Send(mail_service.Message{
+		To:      "test@example.com",
+		Subject: "Reset your password",
+		Body:    "Follow this link\nhttps://example.com/reset-password?token=abc",
+	})
+	assert.NoError(t, err)
+
+	output := buf.String()
+	assert.True(t, strings.Contains(output, "To: test@example.com\r\n"))
+	assert.True(t, strings.Contains(output, "Subject: Reset your password\r\n"))
+	assert.True(t, strings.Contains(output, "https://example.com/reset-password?token=abc"))
+}
+
+func TestWriterMailerRejectsHeaderInjection(t *testing.T) {
+	var buf bytes.Buffer
+	mailer := mail_service.NewWriterMailer(&buf, "no-reply@example.com")
+
+	err := mailer.Send(mail_service.Message{
+		To:      "test@example.com",
+		Subject: "Hello\r\nBcc: victim@example.com",
+		Body:    "Hello",
+	})
+	assert.Equal(t, mail_service.ErrInvalidHeader, err)
+	assert.Empty(t, buf.String())
+}
+
+func TestWriterMailerEncodesSubject(t *testing.T) {
+	var buf bytes.Buffer
+	mailer := mail_service.NewWriterMailer(&buf, "no-reply@example.com")
+
+	err := mailer.Send(mail_service.Message{
+		To:      "test@example.com",
+		Subject: "Список покупок",
+		Body:    "Hello",
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "Subject: =?UTF-8?q?")
+}
+
+func TestGenerateToken(t *testing.T) {
+	first, err := token_service.GenerateToken()
+	assert.NoError(t, err)
+	second, err := token_service.GenerateToken()
+	assert.NoError(t, err)
+
+	assert.NotEqual(t, first, second)
+	assert.Len(t, token_service.HashToken(first), 64)
+	assert.Equal(t, token_service.HashToken(first), token_service.HashToken(first))
+	assert.NotEqual(t, first, token_service.HashToken(first))
+}
@@ -0,0 +1,54 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/Akhanrok/go_labs/repositories/list_repository"
+	"github.com/Akhanrok/go_labs/repositories/product_repository"
+	"github.com/Akhanrok/go_labs/services/merge_service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge(t *testing.T) {
+	lists := []list_repository.ListData{
+		{ID: 1, Products: []product_repository.Product{
+			{Product: "Milk", Quantity: 2, Store: "Lidl"},
+			{Product: "Bread", Quantity: 1, Store: "Bakery"},
+			{Product: "Eggs", Quantity: 10, Store: "Lidl", Purchased: true},
+		}},
+		{ID: 2, Products: []product_repository.Product{
+			{Product: " milk ", Quantity: 3, Store: "LIDL"},
+			{Product: "Bread", Quantity: 2, Store: "Lidl"},
+			{Product: "Eggs", Quantity: 6, Store: "Lidl"},
+		}},
+	}
+
+	// Bread is in two stores and has to be resolved first
+	products, conflicts := merge_service.Merge(lists, nil)
+	assert.Equal(t, []merge_service.Conflict{{
+		Key:     "bread",
+		Product: "Bread",
+		Options: []merge_service.Option{
+			{Key: "store:bakery", Store: "Bakery", Quantity: 1},
+			{Key: "store:lidl", Store: "Lidl", Quantity: 2},
+		},
+	}}, conflicts)
+	// Only the eggs still to buy are added up
+	assert.Equal(t, []product_repository.Product{
+		{Product: "Milk", Quantity: 5, Store: "Lidl"},
+		{Product: "Eggs", Quantity: 6, Store: "Lidl"},
+	}, products)
+
+	products, conflicts = merge_service.Merge(lists, map[string]string{"bread": "store:bakery"})
+	assert.Empty(t, conflicts)
+	assert.Contains(t, products, product_repository.Product{Product: "Bread", Quantity: 3, Store: "Bakery"})
+	assert.Len(t, products, 3)
+
+	products, conflicts = merge_service.Merge(lists, map[string]string{"bread": merge_service.KeepSeparate})
+	assert.Empty(t, conflicts)
+	assert.Len(t, products, 4)
+
+	// Products purchased in every list stay purchased
+	products, _ = merge_service.Merge(lists[:1], nil)
+	assert.Equal(t, product_repository.Product{Product: "Eggs", Quantity: 10, Store: "Lidl", Purchased: true}, products[2])
+}
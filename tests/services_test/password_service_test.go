@@ -0,0 +1,77 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/Akhanrok/go_labs/services/password_service"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBcryptHasher(t *testing.T) {
+	hasher := password_service.NewBcryptHasher(bcrypt.MinCost)
+
+	hash, err := hasher.Hash("password123")
+	assert.NoError(t, err)
+	assert.NotEqual(t, "password123", hash)
+
+	ok, err := hasher.Verify(hash, "password123")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = hasher.Verify(hash, "wrongpassword")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.False(t, hasher.NeedsRehash(hash))
+	assert.True(t, password_service.NewBcryptHasher(bcrypt.MinCost+1).NeedsRehash(hash))
+}
+
+func TestArgon2idHasher(t *testing.T) {
+	hasher := password_service.NewArgon2idHasher(password_service.DefaultArgon2Params)
+
+	hash, err := hasher.Hash("password123")
+	assert.NoError(t, err)
+
+	ok, err := hasher.Verify(hash, "password123")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = hasher.Verify(hash, "wrongpassword")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.False(t, hasher.NeedsRehash(hash))
+	assert.True(t, password_service.NewBcryptHasher(bcrypt.MinCost).NeedsRehash(hash))
+}
+
+func TestLegacyPlaintextPassword(t *testing.T) {
+	hasher := password_service.NewBcryptHasher(bcrypt.MinCost)
+
+	ok, err := hasher.Verify("password123", "password123")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = hasher.Verify("password123", "password124")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.True(t, hasher.NeedsRehash("password123"))
+}
+
+func TestDummyHash(t *testing.T) {
+	hasher := password_service.NewBcryptHasher(bcrypt.MinCost)
+
+	hash, err := password_service.DummyHash(hasher)
+	assert.NoError(t, err)
+
+	// The hash is made once per hasher, with its current parameters
+	again, err := password_service.DummyHash(hasher)
+	assert.NoError(t, err)
+	assert.Equal(t, hash, again)
+	assert.False(t, hasher.NeedsRehash(hash))
+
+	ok, err := hasher.Verify(hash, "")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,40 @@
+package services_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Akhanrok/go_labs/services/qr_service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQREncode(t *testing.T) {
+	// Version 1 at level M holds 14 bytes, one more needs version 2
+	code, err := qr_service.Encode(strings.Repeat("a", 14))
+	assert.NoError(t, err)
+	assert.Equal(t, 21, code.Size)
+
+	code, err = qr_service.Encode(strings.Repeat("a", 15))
+	assert.NoError(t, err)
+	assert.Equal(t, 25, code.Size)
+
+	// Finder patterns sit in three corners, with a light ring inside the dark border
+	for _, corner := range [][2]int{{0, 0}, {code.Size - 7, 0}, {0, code.Size - 7}} {
+		assert.True(t, code.Dark(corner[0], corner[1]))
+		assert.False(t, code.Dark(corner[0]+1, corner[1]+1))
+		assert.True(t, code.Dark(corner[0]+3, corner[1]+3))
+	}
+
+	_, err = qr_service.Encode(strings.Repeat("a", 2332))
+	assert.Equal(t, qr_service.ErrTooLong, err)
+}
+
+func TestQRSVG(t *testing.T) {
+	code, err := qr_service.Encode("otpauth://totp/test")
+	assert.NoError(t, err)
+
+	svg := code.SVG()
+	assert.True(t, strings.HasPrefix(svg, "<svg "))
+	// Version 2 with a quiet zone of four modules on each side
+	assert.Contains(t, svg, `viewBox="0 0 33 33"`)
+}
@@ -0,0 +1,125 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Akhanrok/go_labs/repositories/list_schedule_repository"
+	"github.com/Akhanrok/go_labs/services/schedule_service"
+	"github.com/stretchr/testify/assert"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParseRule(t *testing.T) {
+	rule, err := schedule_service.ParseRule("FREQ=WEEKLY;INTERVAL=2;BYDAY=SA")
+	assert.NoError(t, err)
+	assert.Equal(t, schedule_service.Rule{Frequency: schedule_service.Weekly, Interval: 2, Weekday: time.Saturday}, rule)
+	assert.Equal(t, "FREQ=WEEKLY;INTERVAL=2;BYDAY=SA", rule.String())
+	assert.Equal(t, "every 2 weeks on Saturday", rule.Describe())
+
+	// The interval defaults to 1
+	rule, err = schedule_service.ParseRule("FREQ=MONTHLY;BYMONTHDAY=-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "FREQ=MONTHLY;INTERVAL=1;BYMONTHDAY=-1", rule.String())
+	assert.Equal(t, "every month on the last day", rule.Describe())
+
+	for _, value := range []string{
+		"",
+		"FREQ=DAILY;BYDAY=SA",
+		"FREQ=WEEKLY",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=WEEKLY;INTERVAL=0;BYDAY=SA",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=MONTHLY;BYMONTHDAY=1;COUNT=3",
+	} {
+		_, err := schedule_service.ParseRule(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestRuleNextWeekly(t *testing.T) {
+	rule := schedule_service.Rule{Frequency: schedule_service.Weekly, Interval: 1, Weekday: time.Saturday}
+	start := date(2026, 10, 1) // Thursday
+
+	// The first occurrence is the first Saturday on or after the start
+	assert.Equal(t, date(2026, 10, 3), rule.Next(start, date(2026, 9, 1)))
+	// Occurrences are strictly after the given time
+	assert.Equal(t, date(2026, 10, 10), rule.Next(start, date(2026, 10, 3)))
+	assert.Equal(t, date(2026, 10, 10), rule.Next(start, date(2026, 10, 3).Add(time.Hour)))
+
+	// Every other week counts from the first occurrence
+	rule.Interval = 2
+	assert.Equal(t, []time.Time{date(2026, 10, 17), date(2026, 10, 31), date(2026, 11, 14)},
+		rule.Upcoming(start, date(2026, 10, 4), 3))
+}
+
+func TestRuleNextMonthly(t *testing.T) {
+	rule := schedule_service.Rule{Frequency: schedule_service.Monthly, Interval: 1, MonthDay: 1}
+	start := date(2026, 10, 18)
+
+	// The first of October is before the start
+	assert.Equal(t, date(2026, 11, 1), rule.Next(start, start))
+	assert.Equal(t, date(2026, 12, 1), rule.Next(start, date(2026, 11, 1)))
+
+	// Days past the end of a short month fall on its last day
+	rule.MonthDay = 31
+	assert.Equal(t, []time.Time{date(2026, 10, 31), date(2026, 11, 30), date(2026, 12, 31), date(2027, 1, 31), date(2027, 2, 28)},
+		rule.Upcoming(start, start, 5))
+
+	rule.MonthDay = schedule_service.LastDay
+	rule.Interval = 3
+	assert.Equal(t, []time.Time{date(2026, 10, 31), date(2027, 1, 31), date(2027, 4, 30)},
+		rule.Upcoming(start, start, 3))
+}
+
+// Records the lists the scheduler asks for and claims every occurrence only once
+type fakeScheduleRepository struct {
+	list_schedule_repository.ListScheduleRepository
+	schedules []list_schedule_repository.Schedule
+	generated []string
+	nextRuns  []time.Time
+}
+
+func (r *fakeScheduleRepository) GetDueSchedules(now time.Time) ([]list_schedule_repository.Schedule, error) {
+	var due []list_schedule_repository.Schedule
+	for _, schedule := range r.schedules {
+		if !schedule.NextRunAt.After(now) {
+			due = append(due, schedule)
+		}
+	}
+	return due, nil
+}
+
+func (r *fakeScheduleRepository) Generate(schedule list_schedule_repository.Schedule, name string, nextRunAt time.Time) (int, error) {
+	for i := range r.schedules {
+		if r.schedules[i].ID == schedule.ID && r.schedules[i].NextRunAt.Equal(schedule.NextRunAt) {
+			r.schedules[i].NextRunAt = nextRunAt
+			r.generated = append(r.generated, name)
+			r.nextRuns = append(r.nextRuns, nextRunAt)
+			return len(r.generated), nil
+		}
+	}
+	return 0, nil
+}
+
+func TestRunDueGeneratesMissedOccurrenceOnce(t *testing.T) {
+	repo := &fakeScheduleRepository{schedules: []list_schedule_repository.Schedule{{
+		ID:        1,
+		ListID:    7,
+		ListName:  "Groceries",
+		Rule:      "FREQ=WEEKLY;INTERVAL=1;BYDAY=SA",
+		StartsOn:  date(2026, 9, 1),
+		NextRunAt: date(2026, 10, 3),
+	}}}
+
+	// Two Saturdays were missed while the server was down
+	now := date(2026, 10, 14).Add(9 * time.Hour)
+	schedule_service.RunDue(repo, now)
+	schedule_service.RunDue(repo, now)
+
+	assert.Equal(t, []string{"Groceries 2026-10-03"}, repo.generated)
+	assert.Equal(t, []time.Time{date(2026, 10, 17)}, repo.nextRuns)
+}
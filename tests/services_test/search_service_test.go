@@ -0,0 +1,41 @@
+package services_test
+
+import (
+	"html/template"
+	"testing"
+
+	"github.com/Akhanrok/go_labs/repositories/list_repository"
+	"github.com/Akhanrok/go_labs/repositories/product_repository"
+	"github.com/Akhanrok/go_labs/services/search_service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchTerms(t *testing.T) {
+	assert.Equal(t, []string{"milk", "lidl"}, search_service.Terms(`  "Milk" +lidl* milk `))
+	assert.Equal(t, []string{"молоко", "2"}, search_service.Terms("Молоко 2%"))
+	assert.Empty(t, search_service.Terms(" -*\"' "))
+}
+
+func TestSearchRank(t *testing.T) {
+	terms := search_service.Terms("milk")
+	lists := []list_repository.ListData{
+		{ID: 1, ListName: "Weekend", Products: []product_repository.Product{{Product: "Buttermilk", Store: "Market"}}},
+		{ID: 2, ListName: "Milk run", Products: []product_repository.Product{{Product: "Milk", Store: "Lidl"}}},
+		{ID: 3, ListName: "Breakfast", Products: []product_repository.Product{{Product: "Milk chocolate", Store: "Lidl"}}},
+	}
+
+	search_service.Rank(lists, terms)
+
+	// The list name counts most, a whole word more than the start of one or a part
+	assert.Equal(t, 2, lists[0].ID)
+	assert.Equal(t, 3, lists[1].ID)
+	assert.Equal(t, 1, lists[2].ID)
+}
+
+func TestHighlight(t *testing.T) {
+	terms := search_service.Terms("milk ЛІД")
+
+	assert.Equal(t, template.HTML("Butter<mark>milk</mark> &amp; <mark>MILK</mark>"), search_service.Highlight("Buttermilk & MILK", terms))
+	assert.Equal(t, template.HTML("<mark>Лід</mark>ер"), search_service.Highlight("Лідер", terms))
+	assert.Equal(t, template.HTML("&lt;b&gt;bread&lt;/b&gt;"), search_service.Highlight("<b>bread</b>", terms))
+}
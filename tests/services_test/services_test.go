@@ -1,49 +1,105 @@
-package services_test
-
-import (
-	"net/http"
-	"net/http/httptest"
-	"testing"
-
-	"github.com/Akhanrok/go_labs/services"
-	_ "github.com/go-sql-driver/mysql"
-	"github.com/stretchr/testify/assert"
-)
-
-func TestIsValidEmail(t *testing.T) {
-	// Valid email address
-	validEmail := "test@example.com"
-	assert.True(t, services.IsValidEmail(validEmail))
-
-	// Invalid email addresses
-	invalidEmails := []string{
-		"test@example",
-		"test.example.com",
-		"test@",
-		"@example.com",
-	}
-	for _, email := range invalidEmails {
-		assert.False(t, services.IsValidEmail(email))
-	}
-}
-
-func TestRenderTemplate(t *testing.T) {
-	// Create HTTP response writer
-	w := httptest.NewRecorder()
-
-	// Define the template name and data
-	tmpl := "example.html"
-	data := struct {
-		Title string
-	}{
-		Title: "Example Title",
-	}
-
-	// Call the function
-	services.RenderTemplate(w, tmpl, data)
-
-	// Check the response status code
-	if w.Code != http.StatusOK {
-		t.Errorf("expected status code %d, got %d", http.StatusOK, w.Code)
-	}
-}
+package services_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Akhanrok/go_labs/services"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsValidEmail(t *testing.T) {
+	// Valid email address
+	validEmail := "test@example.com"
+	assert.True(t, services.IsValidEmail(validEmail))
+
+	// Invalid email addresses
+	invalidEmails := []string{
+		"test@example",
+		"test.example.com",
+		"test@",
+		"@example.com",
+	}
+	for _, email := range invalidEmails {
+		assert.False(t, services.IsValidEmail(email))
+	}
+}
+
+// A minimal site with the layout, one partial, one page and one static file
+var testAssets = fstest.MapFS{
+	"templates/layout.html":          {Data: []byte(`{{ define "layout" }}<title>{{ template "title" . }}</title><link href="{{ static "styles.css" }}">{{ template "header" . }}{{ template "content" . }}{{ end }}`)},
+	"templates/partials/header.html": {Data: []byte(`{{ define "header" }}<h1>ShoppingList</h1>{{ end }}`)},
+	"templates/example.html":         {Data: []byte(`{{ define "title" }}{{ .Title }}{{ end }}{{ define "content" }}<p>{{ .Title }}</p>{{ end }}`)},
+	"static/styles.css":              {Data: []byte("body { color: black; }")},
+}
+
+func TestRenderTemplate(t *testing.T) {
+	renderer, err := services.NewRenderer(testAssets, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	services.SetRenderer(renderer)
+
+	// Create HTTP response writer
+	w := httptest.NewRecorder()
+
+	// Define the template name and data
+	tmpl := "example.html"
+	data := struct {
+		Title string
+	}{
+		Title: "Example <Title>",
+	}
+
+	// Call the function
+	req := httptest.NewRequest("GET", "/", nil)
+	services.RenderTemplate(w, req, tmpl, data)
+
+	// Check the response status code
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	// The page is rendered inside the layout with escaped data
+	body := w.Body.String()
+	if !strings.Contains(body, "<p>Example &lt;Title&gt;</p>") || !strings.Contains(body, "<h1>ShoppingList</h1>") {
+		t.Errorf("unexpected body: %s", body)
+	}
+}
+
+func TestNewRendererRejectsBrokenTemplate(t *testing.T) {
+	broken := fstest.MapFS{
+		"templates/layout.html": testAssets["templates/layout.html"],
+		"templates/broken.html": {Data: []byte(`{{ define "content" }}{{ if .Title }}{{ end }}`)},
+	}
+
+	_, err := services.NewRenderer(broken, false)
+	assert.Error(t, err)
+}
+
+func TestStaticFingerprint(t *testing.T) {
+	renderer, err := services.NewRenderer(testAssets, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := renderer.StaticURL("styles.css")
+	assert.Regexp(t, `^/static/styles\.[0-9a-f]{10}\.css$`, url)
+
+	// Fingerprinted names are cached for a long time
+	w := httptest.NewRecorder()
+	http.StripPrefix("/static/", renderer.StaticHandler()).ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "body { color: black; }", w.Body.String())
+	assert.Contains(t, w.Header().Get("Cache-Control"), "immutable")
+
+	// Plain names still work but must be revalidated
+	w = httptest.NewRecorder()
+	http.StripPrefix("/static/", renderer.StaticHandler()).ServeHTTP(w, httptest.NewRequest("GET", "/static/styles.css", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+}
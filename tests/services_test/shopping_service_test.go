@@ -0,0 +1,49 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/Akhanrok/go_labs/repositories/list_repository"
+	"github.com/Akhanrok/go_labs/repositories/product_repository"
+	"github.com/Akhanrok/go_labs/services/shopping_service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestByStore(t *testing.T) {
+	lists := []list_repository.ListData{
+		{ID: 1, ListName: "Weekend", Role: "owner", Products: []product_repository.Product{
+			{ID: 11, Product: "Milk", Quantity: 2, Store: "Lidl"},
+			{ID: 12, Product: "Bread", Quantity: 1, Store: "Bakery"},
+			{ID: 13, Product: "Eggs", Quantity: 10, Store: "Lidl", Purchased: true},
+		}},
+		{ID: 2, ListName: "Party", Role: "editor", Products: []product_repository.Product{
+			{ID: 21, Product: " milk", Quantity: 3, Store: "LIDL "},
+			{ID: 22, Product: "Apples", Quantity: 6, Store: "Lidl"},
+		}},
+		// Viewers can't check products off and archived lists are done
+		{ID: 3, ListName: "Shared", Role: "viewer", Products: []product_repository.Product{
+			{ID: 31, Product: "Milk", Quantity: 1, Store: "Lidl"},
+		}},
+		{ID: 4, ListName: "Old", Role: "owner", Archived: true, Products: []product_repository.Product{
+			{ID: 41, Product: "Milk", Quantity: 1, Store: "Lidl"},
+		}},
+	}
+
+	stores := shopping_service.ByStore(lists)
+
+	assert.Len(t, stores, 2)
+	assert.Equal(t, "Bakery", stores[0].Name)
+	assert.Equal(t, "Lidl", stores[1].Name)
+
+	items := stores[1].Items
+	assert.Len(t, items, 2)
+	assert.Equal(t, "Apples", items[0].Product)
+	assert.Equal(t, "Milk", items[1].Product)
+	assert.Equal(t, 5, items[1].Quantity)
+	assert.Equal(t, []shopping_service.Source{
+		{ListID: 1, ListName: "Weekend", ProductID: 11, Quantity: 2},
+		{ListID: 2, ListName: "Party", ProductID: 21, Quantity: 3},
+	}, items[1].Sources)
+
+	assert.Empty(t, shopping_service.ByStore(nil))
+}
@@ -0,0 +1,126 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Akhanrok/go_labs/services/throttle_service"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestThrottler(clock *fakeClock) *throttle_service.Throttler {
+	cfg := throttle_service.Config{
+		AccountFreeAttempts: 2,
+		IPFreeAttempts:      5,
+		BaseDelay:           time.Second,
+		MaxDelay:            time.Minute,
+		LockoutThreshold:    5,
+		LockoutDuration:     15 * time.Minute,
+		Window:              time.Hour,
+	}
+	return throttle_service.NewThrottler(cfg, throttle_service.NewMemoryStore(cfg.Window, clock), clock)
+}
+
+func TestThrottlerExponentialBackoff(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)}
+	throttler := newTestThrottler(clock)
+
+	// The free attempts are not delayed
+	assert.True(t, throttler.Check("test@example.com", "10.0.0.1").Allowed)
+	assert.True(t, throttler.Check("test@example.com", "10.0.0.1").Allowed)
+	assert.True(t, throttler.Check("test@example.com", "10.0.0.1").Allowed)
+
+	// Every next attempt doubles the delay
+	decision := throttler.Check("test@example.com", "10.0.0.1")
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, time.Second, decision.RetryAfter)
+
+	clock.Advance(time.Second)
+	assert.True(t, throttler.Check("test@example.com", "10.0.0.1").Allowed)
+	assert.Equal(t, 2*time.Second, throttler.Check("test@example.com", "10.0.0.1").RetryAfter)
+
+	// Other accounts from another address are not affected
+	assert.True(t, throttler.Check("other@example.com", "10.0.0.2").Allowed)
+}
+
+func TestThrottlerCountsParallelAttempts(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)}
+	throttler := newTestThrottler(clock)
+
+	// Attempts that were allowed but not answered yet still count
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if throttler.Check("test@example.com", "10.0.0.1").Allowed {
+			allowed++
+		}
+	}
+	assert.Equal(t, 3, allowed)
+}
+
+func TestThrottlerLocksAccount(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)}
+	throttler := newTestThrottler(clock)
+
+	for i := 0; i < 5; i++ {
+		assert.True(t, throttler.Check("test@example.com", "10.0.0.1").Allowed)
+		clock.Advance(time.Minute)
+	}
+
+	// The lock applies from any address
+	decision := throttler.Check("test@example.com", "10.0.0.9")
+	assert.False(t, decision.Allowed)
+	assert.True(t, decision.Locked)
+
+	clock.Advance(15 * time.Minute)
+	assert.True(t, throttler.Check("test@example.com", "10.0.0.9").Allowed)
+}
+
+func TestThrottlerSuccessResetsAccount(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)}
+	throttler := newTestThrottler(clock)
+
+	for i := 0; i < 3; i++ {
+		throttler.Check("test@example.com", "10.0.0.1")
+	}
+	clock.Advance(time.Minute)
+	assert.True(t, throttler.Check("test@example.com", "10.0.0.1").Allowed)
+	throttler.RecordSuccess("test@example.com", "10.0.0.1")
+
+	throttler.Check("test@example.com", "10.0.0.2")
+	assert.True(t, throttler.Check("test@example.com", "10.0.0.2").Allowed)
+}
+
+func TestThrottlerRefund(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)}
+	throttler := newTestThrottler(clock)
+
+	// Attempts that are given back do not add up
+	for i := 0; i < 10; i++ {
+		assert.True(t, throttler.Check("test@example.com", "10.0.0.1").Allowed)
+		throttler.Refund("test@example.com", "10.0.0.1")
+	}
+}
+
+func TestThrottlerWithoutLockout(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)}
+	throttler := throttle_service.NewThrottler(throttle_service.ResendConfig, throttle_service.NewMemoryStore(time.Hour, clock), clock)
+
+	// Requests are only delayed, never locked
+	for i := 0; i < 20; i++ {
+		decision := throttler.Check("test@example.com", "10.0.0.1")
+		assert.False(t, decision.Locked)
+		clock.Advance(time.Hour)
+	}
+}
@@ -0,0 +1,40 @@
+package services_test
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/Akhanrok/go_labs/services/token_service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignedToken(t *testing.T) {
+	secret := []byte("test-secret")
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	token := token_service.SignToken(secret, "42:test@example.com", now.Add(time.Hour))
+
+	payload, err := token_service.VerifySignedToken(secret, token, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "42:test@example.com", payload)
+
+	_, err = token_service.VerifySignedToken(secret, token, now.Add(2*time.Hour))
+	assert.Equal(t, token_service.ErrExpiredToken, err)
+
+	_, err = token_service.VerifySignedToken([]byte("other-secret"), token, now)
+	assert.Equal(t, token_service.ErrInvalidToken, err)
+
+	_, err = token_service.VerifySignedToken(secret, "x"+token, now)
+	assert.Equal(t, token_service.ErrInvalidToken, err)
+}
+
+func TestDeriveKey(t *testing.T) {
+	// Test case 3 of RFC 5869, the first 32 bytes of its output
+	secret, _ := hex.DecodeString("0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b")
+	assert.Equal(t, "8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d", hex.EncodeToString(token_service.DeriveKey(secret, "")))
+
+	// Different labels give unrelated keys
+	assert.NotEqual(t, token_service.DeriveKey(secret, "email-verification"), token_service.DeriveKey(secret, "other"))
+	assert.NotEqual(t, secret, token_service.DeriveKey(secret, "email-verification"))
+}
@@ -0,0 +1,58 @@
+package services_test
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/Akhanrok/go_labs/services/totp_service"
+	"github.com/stretchr/testify/assert"
+)
+
+// The SHA1 secret from the RFC 6238 test vectors
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 lists 8 digit codes, the 6 digit code is their suffix
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, expected := range vectors {
+		code, err := totp_service.Code(rfcSecret, totp_service.Step(time.Unix(unix, 0)))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, code)
+	}
+}
+
+func TestTOTPValidateWithSkew(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	code, err := totp_service.Code(rfcSecret, totp_service.Step(now))
+	assert.NoError(t, err)
+
+	step, ok := totp_service.Validate(rfcSecret, code, now.Add(totp_service.Period))
+	assert.True(t, ok)
+	assert.Equal(t, totp_service.Step(now), step)
+
+	_, ok = totp_service.Validate(rfcSecret, code, now.Add(3*totp_service.Period))
+	assert.False(t, ok)
+
+	_, ok = totp_service.Validate(rfcSecret, "000000", now)
+	assert.False(t, ok)
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := totp_service.GenerateRecoveryCodes(10)
+	assert.NoError(t, err)
+	assert.Len(t, codes, 10)
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		assert.Len(t, code, 11)
+		assert.Equal(t, code, totp_service.NormalizeRecoveryCode(code))
+		assert.False(t, seen[code])
+		seen[code] = true
+	}
+}